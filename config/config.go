@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"scp_delegator/constant"
 	"scp_delegator/logger"
-	"scp_delegator/system/windows"
 	"strings"
 )
 
@@ -41,6 +40,14 @@ func removeBrackets(s string) string {
 	return s
 }
 
+// expandVariables replaces each {alias} in s with value of variable, other brackets are kept.
+func expandVariables(s string) string {
+	for key, val := range VariableMap {
+		s = strings.ReplaceAll(s, "{"+key+"}", val)
+	}
+	return s
+}
+
 func removeSubString(s string, sub string) string {
 	return strings.ReplaceAll(s, sub, "")
 }
@@ -65,7 +72,7 @@ func queryRegKey(value string) (string, error) {
 	if len(args) != 3 {
 		return "", errors.New("input value format is incorrect, format should be `{HKEY_LOCAL_MACHINE}, {SOFTWARE\\TrendMicro\\Deep Security Agent}, {InstallationFolder}`")
 	}
-	s, err := windows.QueryRegKey64(trimAll(args[0], " "), trimAll(args[1], " "), trimAll(args[2], " "))
+	s, err := queryRegKey64(trimAll(args[0], " "), trimAll(args[1], " "), trimAll(args[2], " "))
 	if err != nil {
 		return "", err
 	}
@@ -104,11 +111,33 @@ func traverseConfig(cfg *Config) *Config {
 	cfg.Upload.AzBlob.ContainerName = variablesInterpreter(cfg.Upload.AzBlob.ContainerName)
 	cfg.Upload.AzBlob.AccountName = variablesInterpreter(cfg.Upload.AzBlob.AccountName)
 	cfg.Upload.AzBlob.SASToken = variablesInterpreter(cfg.Upload.AzBlob.SASToken)
+	cfg.Upload.S3.Endpoint = variablesInterpreter(cfg.Upload.S3.Endpoint)
+	cfg.Upload.S3.Region = variablesInterpreter(cfg.Upload.S3.Region)
+	cfg.Upload.S3.Bucket = variablesInterpreter(cfg.Upload.S3.Bucket)
+	cfg.Upload.S3.AccessKeyID = variablesInterpreter(cfg.Upload.S3.AccessKeyID)
+	cfg.Upload.S3.SecretAccessKey = variablesInterpreter(cfg.Upload.S3.SecretAccessKey)
+	cfg.Upload.S3.SessionToken = variablesInterpreter(cfg.Upload.S3.SessionToken)
+	cfg.Upload.Local.Directory = variablesInterpreter(cfg.Upload.Local.Directory)
+	cfg.Upload.HTTP.URL = variablesInterpreter(cfg.Upload.HTTP.URL)
+	cfg.Upload.HTTP.BearerToken = variablesInterpreter(cfg.Upload.HTTP.BearerToken)
+	for name, value := range cfg.Upload.HTTP.Headers {
+		cfg.Upload.HTTP.Headers[name] = variablesInterpreter(value)
+	}
 	cfg.Upload.Proxy.Host = variablesInterpreter(cfg.Upload.Proxy.Host)
+	cfg.Upload.Proxy.Username = variablesInterpreter(cfg.Upload.Proxy.Username)
+	cfg.Upload.Proxy.Password = variablesInterpreter(cfg.Upload.Proxy.Password)
+	cfg.Upload.Proxy.Domain = variablesInterpreter(cfg.Upload.Proxy.Domain)
+	cfg.Upload.Encryption.RecipientPublicKey = variablesInterpreter(cfg.Upload.Encryption.RecipientPublicKey)
 	cfg.Upload.SEGCaseID = variablesInterpreter(cfg.Upload.SEGCaseID)
 	cfg.Upload.CompanyID = variablesInterpreter(cfg.Upload.CompanyID)
 	cfg.Upload.DeviceID = variablesInterpreter(cfg.Upload.DeviceID)
 
+	// Traverse Bundles
+	for i, b := range cfg.Bundles {
+		cfg.Bundles[i].Archive = variablesInterpreter(b.Archive)
+		cfg.Bundles[i].Destination = variablesInterpreter(b.Destination)
+	}
+
 	// Traverse Tasks
 	for i, task := range cfg.Tasks {
 		cfg.Tasks[i].Name = variablesInterpreter(task.Name)
@@ -117,8 +146,20 @@ func traverseConfig(cfg *Config) *Config {
 	// Traverse Template
 	for i, act := range cfg.Template.Actions {
 		cfg.Template.Actions[i].Name = variablesInterpreter(act.Name)
-		cfg.Template.Actions[i].Executable = variablesInterpreter(act.Executable)
+		// Paths may contain brackets like "Program Files (x86)", so only exact variable placeholders are replaced.
+		cfg.Template.Actions[i].Executable = expandVariables(act.Executable)
+		cfg.Template.Actions[i].WorkingDir = expandVariables(act.WorkingDir)
+		for key, val := range act.Env {
+			cfg.Template.Actions[i].Env[key] = expandVariables(val)
+		}
+		for j, path := range act.Paths {
+			cfg.Template.Actions[i].Paths[j] = expandVariables(path)
+		}
+		for j, path := range act.RequiredFiles {
+			cfg.Template.Actions[i].RequiredFiles[j] = expandVariables(path)
+		}
 		cfg.Template.Actions[i].Output = variablesInterpreter(act.Output)
+		cfg.Template.Actions[i].ErrorOutput = variablesInterpreter(act.ErrorOutput)
 		for j, arg := range act.Arguments {
 			cfg.Template.Actions[i].Arguments[j].Command = variablesInterpreter(arg.Command)
 			cfg.Template.Actions[i].Arguments[j].Value = variablesInterpreter(arg.Value)
@@ -127,11 +168,21 @@ func traverseConfig(cfg *Config) *Config {
 	for i, cond := range cfg.Template.Conditions {
 		cfg.Template.Conditions[i].Name = variablesInterpreter(cond.Name)
 		cfg.Template.Conditions[i].TargetProcess = variablesInterpreter(cond.TargetProcess)
+		cfg.Template.Conditions[i].TargetPath = variablesInterpreter(cond.TargetPath)
+		// Expression contains parentheses, so only exact variable placeholders are replaced.
+		cfg.Template.Conditions[i].Expression = expandVariables(cond.Expression)
 	}
 
 	for i, cri := range cfg.Template.ConditionCriteria {
 		cfg.Template.ConditionCriteria[i].Type = variablesInterpreter(cri.Type)
 		cfg.Template.ConditionCriteria[i].Operator = variablesInterpreter(cri.Operator)
+		cfg.Template.ConditionCriteria[i].Function = variablesInterpreter(cri.Function)
+		// Paths may contain glob brackets like "*.[0-9].log", so only exact variable placeholders are replaced.
+		for j, path := range cri.Paths {
+			cfg.Template.ConditionCriteria[i].Paths[j] = expandVariables(path)
+		}
+		// Target may be IPv6 address in brackets, so only exact variable placeholders are replaced.
+		cfg.Template.ConditionCriteria[i].Target = expandVariables(cri.Target)
 	}
 	return cfg
 }
@@ -2,8 +2,14 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"scp_delegator/constant"
+	"scp_delegator/crypto"
 	"scp_delegator/logger"
 )
 
@@ -17,6 +23,7 @@ type Config struct {
 	Template  Template   `json:"template"`
 	Variables []Variable `json:"variables"`
 	Upload    Upload     `json:"upload"`
+	Bundles   []Bundle   `json:"bundles"`
 }
 
 // Task struct formed by customized task which user defined.
@@ -36,15 +43,37 @@ type Template struct {
 }
 
 // Action material is the operation adopt by user defined task.
+// Kind "embedded" (default) runs a tool embedded in executor, and kind "exec" runs an allow-listed
+// Executable directly, which is an absolute path, a path relative to WorkingDir or a name looked up in PATH.
+// Arguments are quoted one by one, unless RawCommandLine is set and they are joined by space as is.
+// Native kinds run in process, they read Paths and write into Output under output directory.
+// Output of commands is streamed into Output, and stderr into ErrorOutput if it is given. Lines are prefixed with
+// time and stream name if TagOutput is set. Each file is limited to MaxOutputMB, when it is full the file is rotated
+// keeping OutputRotation old files, or further output is dropped if OutputRotation is zero.
+// Action succeeds if exit code is one of SuccessExitCodes (0 if not given), a line of output matches RequiredOutput,
+// no line matches ForbiddenOutput, and every pattern of RequiredFiles matches a file.
 type Action struct {
-	ID         uint32     `json:"id"`
-	PreAction  uint32     `json:"pre_action"`
-	Name       string     `json:"name"`
-	Executable string     `json:"executable"`
-	Arguments  []Argument `json:"arguments"`
-	PostAction uint32     `json:"post_action"`
-	Property   uint32     `json:"property"`
-	Output     string     `json:"output"`
+	ID               uint32            `json:"id"`
+	PreAction        uint32            `json:"pre_action"`
+	Name             string            `json:"name"`
+	Kind             string            `json:"kind"`
+	Executable       string            `json:"executable"`
+	Arguments        []Argument        `json:"arguments"`
+	RawCommandLine   bool              `json:"raw_command_line"`
+	WorkingDir       string            `json:"working_dir"`
+	Env              map[string]string `json:"env"`
+	Paths            []string          `json:"paths"`
+	PostAction       uint32            `json:"post_action"`
+	Property         uint32            `json:"property"`
+	Output           string            `json:"output"`
+	ErrorOutput      string            `json:"error_output"`
+	TagOutput        bool              `json:"tag_output"`
+	MaxOutputMB      uint32            `json:"max_output_MB"`
+	OutputRotation   uint32            `json:"output_rotation"`
+	SuccessExitCodes []int             `json:"success_exit_codes"`
+	RequiredOutput   string            `json:"required_output"`
+	ForbiddenOutput  string            `json:"forbidden_output"`
+	RequiredFiles    []string          `json:"required_files"`
 }
 
 // Argument is command of executable program
@@ -59,6 +88,7 @@ type ActionProperty struct {
 	TimeoutS uint32         `json:"timeout_sec"`
 	PeriodS  uint32         `json:"period_sec"`
 	Repeat   RepeatProperty `json:"repeat"`
+	Retry    RetryProperty  `json:"retry"`
 }
 
 // RepeatProperty struct stores repeat count and interval of each operation.
@@ -67,13 +97,29 @@ type RepeatProperty struct {
 	IntervalS uint32 `json:"interval_sec"`
 }
 
+// RetryProperty struct stores how many times a failed action is retried, delay is doubled after each retry
+// until it reaches MaxDelayS.
+type RetryProperty struct {
+	Count     uint32 `json:"count"`
+	DelayS    uint32 `json:"delay_sec"`
+	MaxDelayS uint32 `json:"max_delay_sec"`
+}
+
 // Condition struct is condition template before perform actions.
+// Monitored processes are those match all given monitor fields, and Aggregation decides
+// how per-process metrics are combined (sum, max, any or all).
+// Expression takes precedence over Criteria if it is given.
 type Condition struct {
-	ID            uint32   `json:"id"`
-	Name          string   `json:"name"`
-	TargetProcess string   `json:"monitor_process"`
-	TimeoutS      uint32   `json:"timeout_sec"`
-	Criteria      Criteria `json:"criteria"`
+	ID             uint32   `json:"id"`
+	Name           string   `json:"name"`
+	TargetProcess  string   `json:"monitor_process"`
+	TargetPath     string   `json:"monitor_path"`
+	TargetCmdline  string   `json:"monitor_cmdline"`
+	TargetParentID uint32   `json:"monitor_parent_pid"`
+	Aggregation    string   `json:"aggregation"`
+	Expression     string   `json:"expression"`
+	TimeoutS       uint32   `json:"timeout_sec"`
+	Criteria       Criteria `json:"criteria"`
 }
 
 // Criteria is rule set of ConditionsCriteria which need fulfill mandatory criteria and least one of optional criteria.
@@ -83,13 +129,23 @@ type Criteria struct {
 }
 
 // ConditionCriteria is boundary of condition trigger point.
+// Criterion is sampled every Interval, and compared by Function (avg, p95, max, min or rate)
+// over samples of latest WindowS seconds if Function is given, otherwise by latest sample.
+// Paths are read by file, disk and LogPattern criteria and may contain glob patterns, Pattern is regular
+// expression of LogPattern criteria, and Target is host:port, host name or URL probed by network criteria.
 type ConditionCriteria struct {
-	ID         uint32 `json:"id"`
-	Type       string `json:"type"`
-	Interval   uint32 `json:"interval_sec"`
-	Threshold  uint32 `json:"threshold"`
-	Operator   string `json:"operator"`
-	MaturityMS uint32 `json:"maturity_ms"`
+	ID         uint32    `json:"id"`
+	Type       string    `json:"type"`
+	Interval   uint32    `json:"interval_sec"`
+	Function   string    `json:"function"`
+	WindowS    uint32    `json:"window_sec"`
+	Threshold  Threshold `json:"threshold"`
+	Operator   string    `json:"operator"`
+	MaturityMS uint32    `json:"maturity_ms"`
+	Paths      []string  `json:"paths"`
+	Pattern    string    `json:"pattern"`
+	Target     string    `json:"target"`
+	TimeoutMS  uint32    `json:"timeout_ms"`
 }
 
 // Variable composed by alias and value store in an element of map.
@@ -98,17 +154,33 @@ type Variable struct {
 	Value string `json:"value"`
 }
 
+// Bundle is an archive which extracted to destination before running tasks.
+type Bundle struct {
+	Archive     string `json:"archive"`
+	Destination string `json:"destination"`
+	MaxSizeMB   uint32 `json:"max_size_MB"`
+}
+
 // Upload structure stores upload setting
 type Upload struct {
-	AzBlob         AzBlob `json:"azure_blob"`
-	Proxy          Proxy  `json:"proxy"`
-	MaxBlockSizeMB uint32 `json:"max_block_size_MB"`
-	RateLimitMB    uint32 `json:"rate_limit_MB"`
-	TimeoutS       uint32 `json:"timeout_sec"`
-	MaxRetryCount  uint32 `json:"max_retry_count"`
-	SEGCaseID      string `json:"seg_case_id"`
-	CompanyID      string `json:"company_id"`
-	DeviceID       string `json:"device_id"`
+	Backend        string     `json:"backend"`
+	AzBlob         AzBlob     `json:"azure_blob"`
+	S3             S3         `json:"s3"`
+	Local          Local      `json:"local"`
+	HTTP           HTTPUpload `json:"http"`
+	Proxy          Proxy      `json:"proxy"`
+	Encryption     Encryption `json:"encryption"`
+	MaxBlockSizeMB uint32     `json:"max_block_size_MB"`
+	CompressFormat string     `json:"compress_format"`
+	RateLimitMB    uint32     `json:"rate_limit_MB"`
+	TimeoutS       uint32     `json:"timeout_sec"`
+	MaxRetryCount  uint32     `json:"max_retry_count"`
+	RetryDelayS    uint32     `json:"retry_delay_sec"`
+	MaxRetryDelayS uint32     `json:"max_retry_delay_sec"`
+	TryTimeoutS    uint32     `json:"try_timeout_sec"`
+	SEGCaseID      string     `json:"seg_case_id"`
+	CompanyID      string     `json:"company_id"`
+	DeviceID       string     `json:"device_id"`
 }
 
 // AzBlob struct stores upload properties of Azure Blob needed
@@ -119,14 +191,55 @@ type AzBlob struct {
 	SASToken      string `json:"sas_token"`
 }
 
-// Proxy struct composed by host and port.
+// S3 struct stores upload properties of S3 compatible storage needed
+type S3 struct {
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+	PathStyle       bool   `json:"path_style"`
+}
+
+// Local struct stores destination directory or UNC share of local upload backend
+type Local struct {
+	Directory string `json:"directory"`
+}
+
+// HTTPUpload struct stores properties of generic HTTP(S) upload backend,
+// URL accepts placeholders {seg_case_id}, {company_id}, {device_id} and {file_name}.
+type HTTPUpload struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method"`
+	Multipart      bool              `json:"multipart"`
+	FormField      string            `json:"form_field"`
+	Headers        map[string]string `json:"headers"`
+	BearerToken    string            `json:"bearer_token"`
+	ExpectedStatus []int             `json:"expected_status"`
+}
+
+// Encryption struct stores recipient key of collected artifacts, encryption is disabled if key is empty.
+type Encryption struct {
+	RecipientPublicKey string `json:"recipient_public_key"`
+}
+
+// Proxy struct composed by host, port and credential. Auth is "basic" or "ntlm",
+// requests fallback to direct connection when proxy is unreachable unless DisableDirectFallback is set.
 type Proxy struct {
-	Host string `json:"host"`
-	Port uint16 `json:"port"`
+	Host                  string   `json:"host"`
+	Port                  uint16   `json:"port"`
+	Scheme                string   `json:"scheme"`
+	Auth                  string   `json:"auth"`
+	Username              string   `json:"username"`
+	Password              string   `json:"password"`
+	Domain                string   `json:"domain"`
+	NoProxy               []string `json:"no_proxy"`
+	DisableDirectFallback bool     `json:"disable_direct_fallback"`
 }
 
 func readProfile() ([]byte, error) {
-	f, err := os.Open("profile.json")
+	f, err := os.Open(constant.ProfileName)
 	defer f.Close()
 	if err != nil {
 		logger.Wrapper.LogError("Can't open profile with error %s", err)
@@ -141,16 +254,95 @@ func readProfile() ([]byte, error) {
 	return s, nil
 }
 
+// readPublicKey returns embedded public key, or content of public key file configured in build time.
+// Key file must be given by absolute path and not writable by group or others, so that it can't be replaced
+// by whoever can write the profile.
+func readPublicKey() ([]byte, error) {
+	if constant.ProfilePublicKey != "" {
+		return []byte(constant.ProfilePublicKey), nil
+	}
+
+	p := constant.ProfilePublicKeyPath
+	if p == "" {
+		return nil, errors.New("no public key embedded or configured for verifying profile")
+	}
+	if !filepath.IsAbs(p) {
+		return nil, errors.New(fmt.Sprintf("public key path %s is not absolute", p))
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	// Permission bits aren't meaningful on Windows, where the path is expected under a protected directory.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0022 != 0 {
+		return nil, errors.New(fmt.Sprintf("public key file %s is writable by group or others", p))
+	}
+	return ioutil.ReadFile(p)
+}
+
+func verifyProfileSignature(profile []byte) error {
+	s, err := readPublicKey()
+	if err != nil {
+		return err
+	}
+	key, err := crypto.ParseSigningPublicKey(s)
+	if err != nil {
+		return err
+	}
+
+	sig, err := ioutil.ReadFile(constant.ProfileSignatureName)
+	if err != nil {
+		return err
+	}
+	return crypto.VerifyProfile(profile, sig, key)
+}
+
+// ProfileValidator checks parsed config, the profile is refused if error returned.
+type ProfileValidator func(cfg *Config) error
+
+var profileValidators []ProfileValidator
+
+// VerifyProfileSignature decides whether ParseProfile refuses profile without valid signature.
+var VerifyProfileSignature = true
+
+// RegisterValidator adds validator which will be applied by ParseProfile.
+func RegisterValidator(v ProfileValidator) {
+	profileValidators = append(profileValidators, v)
+}
+
 // ParseProfile will parse profile at current directory.
+// It returns nil if profile can't be parsed or fails any registered validator.
 func ParseProfile() *Config {
 	cfg := &Config{}
 	profile, err := readProfile()
 	if err != nil {
 		return nil
 	}
-	json.Unmarshal(profile, cfg)
+
+	if VerifyProfileSignature {
+		if err := verifyProfileSignature(profile); err != nil {
+			logger.Wrapper.LogError("Profile signature verification failed with error %s", err)
+			return nil
+		}
+		logger.Wrapper.LogInfo("Profile signature verified")
+	} else {
+		logger.Wrapper.LogInfo("Profile signature verification is skipped")
+	}
+
+	err = json.Unmarshal(profile, cfg)
+	if err != nil {
+		logger.Wrapper.LogError("Can't parse profile with error %s", err)
+		return nil
+	}
 
 	// Parse variable
 	cfg = traverseConfig(cfg)
+
+	for _, v := range profileValidators {
+		if err := v(cfg); err != nil {
+			logger.Wrapper.LogError("Profile is refused, %s", err)
+			return nil
+		}
+	}
 	return cfg
 }
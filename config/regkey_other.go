@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"errors"
+)
+
+func queryRegKey64(keyCategory string, keyPath string, key string) (string, error) {
+	return "", errors.New("registry key variable is only supported on Windows")
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package config
+
+import (
+	"scp_delegator/system/windows"
+)
+
+func queryRegKey64(keyCategory string, keyPath string, key string) (string, error) {
+	return windows.QueryRegKey64(keyCategory, keyPath, key)
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UnitPercent is unit of threshold which is relative to total capacity.
+const UnitPercent = "%"
+
+// SizeUnits are multipliers of size units of threshold in bytes.
+var SizeUnits = map[string]float64{
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// Threshold is boundary value of criteria, given as a number, or a string with unit like "512MB", "5GB" or "10%".
+// Number without unit is interpreted in default unit of criteria type.
+type Threshold struct {
+	Value float64
+	Unit  string
+}
+
+// ParseThreshold parses number followed by optional unit, unit is case insensitive.
+func ParseThreshold(s string) (Threshold, error) {
+	s = strings.TrimSpace(s)
+	end := len(s)
+	for end > 0 && !strings.ContainsAny(s[end-1:end], "0123456789.") {
+		end--
+	}
+	value, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return Threshold{}, errors.New(fmt.Sprintf("invalid threshold %s", s))
+	}
+	unit := strings.ToUpper(strings.TrimSpace(s[end:]))
+	if _, ok := SizeUnits[unit]; !ok && unit != "" && unit != UnitPercent {
+		return Threshold{}, errors.New(fmt.Sprintf("unknown unit %s of threshold %s", unit, s))
+	}
+	return Threshold{Value: value, Unit: unit}, nil
+}
+
+// UnmarshalJSON accepts both number and string, so profiles with number thresholds are still valid.
+func (t *Threshold) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := ParseThreshold(s)
+		if err != nil {
+			return err
+		}
+		*t = parsed
+		return nil
+	}
+	t.Unit = ""
+	return json.Unmarshal(b, &t.Value)
+}
+
+func (t Threshold) MarshalJSON() ([]byte, error) {
+	if t.Unit == "" {
+		return json.Marshal(t.Value)
+	}
+	return json.Marshal(t.String())
+}
+
+func (t Threshold) String() string {
+	return strconv.FormatFloat(t.Value, 'g', -1, 64) + t.Unit
+}
@@ -1,17 +1,23 @@
 package constant
 
 const (
-	ExecutorName       = "rp_main.exe"
-	OutputDirectory    = "Log"
-	LogFileName        = "ds_scp.log"
-	CompressedFileName = "log.7z"
+	ExecutorName         = "rp_main.exe"
+	OutputDirectory      = "Log"
+	LogFileName          = "ds_scp.log"
+	CompressedFileName   = "log"
+	ActionResultFileName = "action_results.jsonl"
+)
+
+// Compress formats
+const (
+	CompressFormatZip   = "zip"
+	CompressFormatTarGz = "tar.gz"
 )
 
 // Windows
 const (
-	WindowsXBCLogDir32   = "C:\\Program Files (x86)\\Trend Micro\\Endpoint Basecamp\\log"
-	WindowsXBCLogDir64   = "C:\\Program Files (x86)\\Trend Micro\\Endpoint Basecamp\\log"
-	WindowsZipToolBinary = "7z.exe"
+	WindowsXBCLogDir32 = "C:\\Program Files (x86)\\Trend Micro\\Endpoint Basecamp\\log"
+	WindowsXBCLogDir64 = "C:\\Program Files (x86)\\Trend Micro\\Endpoint Basecamp\\log"
 )
 
 // Linux
@@ -29,3 +35,47 @@ var EmbedBinaryOptions = map[string]string{
 	"sendCommand.cmd":     `-s`,
 	"ratt.exe":            `-r`,
 }
+
+// AllowedExecutables lists programs which exec actions are allowed to run. An entry with directory must equal to
+// the resolved path, a bare name only allows the program found by that name in PATH, case insensitively on Windows.
+var AllowedExecutables = []string{
+	"wpr.exe",
+	"xperf.exe",
+	"logman.exe",
+	"netsh.exe",
+	"pktmon.exe",
+	"procdump.exe",
+	"procdump64.exe",
+	"tasklist.exe",
+	"ipconfig.exe",
+	"dsa_control.cmd",
+	"dsa_query.cmd",
+	"sendCommand.cmd",
+	"tcpdump",
+	"ss",
+	"ps",
+	"dmesg",
+	"journalctl",
+}
+
+// ExtraAllowedExecutables extends AllowedExecutables in build time, entries are separated by semicolon,
+// for example -ldflags "-X scp_delegator/constant.ExtraAllowedExecutables=perf;C:\Tools\collect.bat".
+var ExtraAllowedExecutables = ""
+
+// Profile
+const (
+	ProfileName          = "profile.json"
+	ProfileSignatureName = "profile.json.sig"
+	ProfilePublicKeyName = "profile.pub"
+	ModeLocal            = "local"
+	ModeManaged          = "managed"
+)
+
+// ProfilePublicKey is embedded Ed25519 public key for verifying profile signature,
+// assign it in build time by -ldflags "-X scp_delegator/constant.ProfilePublicKey=<base64 key>".
+var ProfilePublicKey = ""
+
+// ProfilePublicKeyPath is absolute path of public key file used when no key is embedded, it should be a location
+// only administrators can write, e.g. -ldflags "-X scp_delegator/constant.ProfilePublicKeyPath=/etc/scp/profile.pub".
+// Profile is refused if neither key nor path is assigned.
+var ProfilePublicKeyPath = ""
@@ -0,0 +1,7 @@
+//go:build dev
+// +build dev
+
+package constant
+
+// LocalModeAllowed is true only in dev build (go build -tags dev), local mode skips profile signature verification.
+const LocalModeAllowed = true
@@ -1 +1,23 @@
 package crypto
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// decodeKey accepts key in PEM or base64 format, returns DER/raw bytes and PEM type if any.
+func decodeKey(s []byte) ([]byte, string, error) {
+	block, _ := pem.Decode(s)
+	if block != nil {
+		return block.Bytes, block.Type, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(s)))
+	if err != nil {
+		return nil, "", errors.New(fmt.Sprintf("key is neither PEM nor base64 format, error=%s", err))
+	}
+	return raw, "", nil
+}
@@ -0,0 +1,342 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Encrypted file layout:
+//
+//	magic (8 bytes) | wrapped key length (2 bytes) | wrapped key | base nonce (12 bytes) | chunks...
+//	chunk: ciphertext length (4 bytes) | final flag (1 byte) | AES-GCM ciphertext
+const (
+	EncryptedFileSuffix = ".enc"
+
+	envelopeMagic  = "SCPENC01"
+	envelopeKeyLen = 32
+	chunkSize      = 1 << 20
+)
+
+// Envelope holds per-bundle data key and its wrapped form for recipient.
+type Envelope struct {
+	aead       cipher.AEAD
+	wrappedKey []byte
+}
+
+// NewEnvelope generates random AES-256-GCM data key and wraps it with recipient RSA public key.
+func NewEnvelope(recipient *rsa.PublicKey) (*Envelope, error) {
+	key := make([]byte, envelopeKeyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, recipient, key, []byte(envelopeMagic))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{aead: aead, wrappedKey: wrapped}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(base []byte, index uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], index)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-8+i] ^= counter[i]
+	}
+	return nonce
+}
+
+func chunkAdditionalData(index uint64, final byte) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, index)
+	ad[8] = final
+	return ad
+}
+
+// Encrypt reads plaintext from r and writes encrypted stream to w.
+func (e *Envelope) Encrypt(w io.Writer, r io.Reader) error {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	header := bytes.NewBufferString(envelopeMagic)
+	binary.Write(header, binary.BigEndian, uint16(len(e.wrappedKey)))
+	header.Write(e.wrappedKey)
+	header.Write(nonce)
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(r, chunkSize)
+	buf := make([]byte, chunkSize)
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		// Peek to know whether this is the last chunk, the final flag prevents truncation.
+		var final byte
+		if _, peekErr := br.Peek(1); peekErr == io.EOF {
+			final = 1
+		}
+
+		ct := e.aead.Seal(nil, chunkNonce(nonce, index), buf[:n], chunkAdditionalData(index, final))
+		var chunkHeader [5]byte
+		binary.BigEndian.PutUint32(chunkHeader[:4], uint32(len(ct)))
+		chunkHeader[4] = final
+		if _, err := w.Write(chunkHeader[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(ct); err != nil {
+			return err
+		}
+
+		if final == 1 {
+			return nil
+		}
+	}
+}
+
+// EncryptFile encrypts src file into dst file.
+func (e *Envelope) EncryptFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = e.Encrypt(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// Decrypt reads encrypted stream from r, unwraps data key by recipient private key and writes plaintext to w.
+func Decrypt(w io.Writer, r io.Reader, recipient *rsa.PrivateKey) error {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(envelopeMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != envelopeMagic {
+		return errors.New("input is not an encrypted file")
+	}
+
+	var keyLen uint16
+	if err := binary.Read(br, binary.BigEndian, &keyLen); err != nil {
+		return err
+	}
+	wrapped := make([]byte, keyLen)
+	if _, err := io.ReadFull(br, wrapped); err != nil {
+		return err
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, recipient, wrapped, []byte(envelopeMagic))
+	if err != nil {
+		return errors.New(fmt.Sprintf("can't unwrap data key, error=%s", err))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return err
+	}
+
+	for index := uint64(0); ; index++ {
+		var chunkHeader [5]byte
+		if _, err := io.ReadFull(br, chunkHeader[:]); err != nil {
+			return errors.New("encrypted file is truncated")
+		}
+		size := binary.BigEndian.Uint32(chunkHeader[:4])
+		if size > chunkSize+uint32(aead.Overhead()) {
+			return errors.New(fmt.Sprintf("invalid chunk size %d", size))
+		}
+
+		ct := make([]byte, size)
+		if _, err := io.ReadFull(br, ct); err != nil {
+			return errors.New("encrypted file is truncated")
+		}
+		final := chunkHeader[4]
+		pt, err := aead.Open(nil, chunkNonce(nonce, index), ct, chunkAdditionalData(index, final))
+		if err != nil {
+			return errors.New(fmt.Sprintf("chunk %d authentication failed", index))
+		}
+		if _, err := w.Write(pt); err != nil {
+			return err
+		}
+
+		if final == 1 {
+			if _, err := br.Peek(1); err != io.EOF {
+				return errors.New("unexpected data after final chunk")
+			}
+			return nil
+		}
+	}
+}
+
+// DecryptFile decrypts src file into dst file.
+func DecryptFile(src string, dst string, recipient *rsa.PrivateKey) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = Decrypt(out, in, recipient)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// ParseRecipientPublicKey parses RSA public key in PEM (PKIX or PKCS1) or base64 of PKIX format.
+func ParseRecipientPublicKey(s []byte) (*rsa.PublicKey, error) {
+	raw, pemType, err := decodeKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if pemType == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(raw)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("recipient public key is not RSA key")
+	}
+	return pub, nil
+}
+
+// ParseRecipientPrivateKey parses RSA private key in PEM (PKCS8 or PKCS1) format.
+func ParseRecipientPrivateKey(s []byte) (*rsa.PrivateKey, error) {
+	raw, pemType, err := decodeKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if pemType == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(raw)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("recipient private key is not RSA key")
+	}
+	return priv, nil
+}
+
+// GenerateRecipientKey creates RSA key pair, returns PEM encoded private key and public key.
+func GenerateRecipientKey(bits int) ([]byte, []byte, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return privPEM, pubPEM, nil
+}
+
+// LoadRecipientPublicKey accepts key content or path of key file.
+func LoadRecipientPublicKey(s string) (*rsa.PublicKey, error) {
+	if key, err := ParseRecipientPublicKey([]byte(s)); err == nil {
+		return key, nil
+	}
+
+	content, err := ioutil.ReadFile(s)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("recipient public key is neither valid key nor readable file, error=%s", err))
+	}
+	return ParseRecipientPublicKey(content)
+}
+
+// EncryptFiles encrypts files of one bundle with same data key into <file>.enc. Plaintext files are removed
+// only after all of them are encrypted, on failure encrypted files are removed and plaintext files are kept.
+func EncryptFiles(files []string, recipient *rsa.PublicKey) ([]string, error) {
+	e, err := NewEnvelope(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]string, 0, len(files))
+	for _, f := range files {
+		dst := f + EncryptedFileSuffix
+		if err := e.EncryptFile(f, dst); err != nil {
+			for _, done := range encrypted {
+				os.Remove(done)
+			}
+			return nil, err
+		}
+		encrypted = append(encrypted, dst)
+	}
+
+	// Plaintext left in output directory defeats encryption, so failing to remove it is an error.
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			return nil, errors.New(fmt.Sprintf("can't remove plaintext file %s, error=%s", f, err))
+		}
+	}
+	return encrypted, nil
+}
@@ -0,0 +1,183 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testRecipientOnce sync.Once
+var testRecipient *rsa.PrivateKey
+
+// recipientKey returns RSA key shared by tests, generating it is slow.
+func recipientKey(t *testing.T) *rsa.PrivateKey {
+	testRecipientOnce.Do(func() {
+		privPEM, _, err := GenerateRecipientKey(2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testRecipient, err = ParseRecipientPrivateKey(privPEM); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return testRecipient
+}
+
+func encryptBytes(t *testing.T, plaintext []byte) []byte {
+	e, err := NewEnvelope(&recipientKey(t).PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := e.Encrypt(&buf, bytes.NewReader(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encryptedChunks splits encrypted stream into header and chunks with their headers.
+func encryptedChunks(t *testing.T, data []byte) ([]byte, [][]byte) {
+	offset := len(envelopeMagic) + 2 + int(binary.BigEndian.Uint16(data[len(envelopeMagic):])) + 12
+	header := data[:offset]
+	var chunks [][]byte
+	for offset < len(data) {
+		end := offset + 5 + int(binary.BigEndian.Uint32(data[offset:]))
+		if end > len(data) {
+			t.Fatalf("chunk at %d exceeds stream of %d bytes", offset, len(data))
+		}
+		chunks = append(chunks, data[offset:end])
+		offset = end
+	}
+	return header, chunks
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2*chunkSize + 10} {
+		plaintext := make([]byte, size)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		data := encryptBytes(t, plaintext)
+
+		// Exact multiple of chunk size has no empty final chunk, empty plaintext has one.
+		_, chunks := encryptedChunks(t, data)
+		want := (size + chunkSize - 1) / chunkSize
+		if want == 0 {
+			want = 1
+		}
+		if len(chunks) != want {
+			t.Errorf("%d bytes are encrypted into %d chunks, want %d", size, len(chunks), want)
+		}
+
+		var out bytes.Buffer
+		if err := Decrypt(&out, bytes.NewReader(data), recipientKey(t)); err != nil {
+			t.Errorf("decrypting %d bytes failed with error %s", size, err)
+		} else if !bytes.Equal(out.Bytes(), plaintext) {
+			t.Errorf("decrypted %d bytes doesn't match plaintext of %d bytes", out.Len(), size)
+		}
+	}
+}
+
+func TestEnvelopeTampered(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("log line\n"), chunkSize/4)
+	data := encryptBytes(t, plaintext)
+	header, chunks := encryptedChunks(t, data)
+	if len(chunks) != 3 {
+		t.Fatalf("plaintext is encrypted into %d chunks, want 3", len(chunks))
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(append([][]byte{header}, parts...), nil)
+	}
+	flip := func(b []byte, i int) []byte {
+		c := append([]byte{}, b...)
+		c[i] ^= 1
+		return c
+	}
+
+	otherPEM, _, err := GenerateRecipientKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ParseRecipientPrivateKey(otherPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		key  *rsa.PrivateKey
+		want string
+	}{
+		{"final chunk dropped", join(chunks[0], chunks[1]), recipientKey(t), "truncated"},
+		{"cut in chunk", data[:len(data)-10], recipientKey(t), "truncated"},
+		{"header only", header, recipientKey(t), "truncated"},
+		{"chunks reordered", join(chunks[1], chunks[0], chunks[2]), recipientKey(t), "chunk 0 authentication failed"},
+		{"chunk duplicated", join(chunks[0], chunks[0], chunks[1], chunks[2]), recipientKey(t), "chunk 1 authentication failed"},
+		{"ciphertext bit flipped", join(chunks[0], flip(chunks[1], 100), chunks[2]), recipientKey(t), "chunk 1 authentication failed"},
+		{"final flag set early", join(flip(chunks[0], 4)), recipientKey(t), "chunk 0 authentication failed"},
+		{"final flag cleared", join(chunks[0], chunks[1], flip(chunks[2], 4)), recipientKey(t), "chunk 2 authentication failed"},
+		{"trailing garbage", append(append([]byte{}, data...), 0), recipientKey(t), "unexpected data after final chunk"},
+		{"wrapped key flipped", flip(data, len(envelopeMagic)+10), recipientKey(t), "can't unwrap data key"},
+		{"wrong key", data, other, "can't unwrap data key"},
+		{"not encrypted", plaintext, recipientKey(t), "not an encrypted file"},
+	}
+	for _, c := range cases {
+		err := Decrypt(ioutil.Discard, bytes.NewReader(c.data), c.key)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("decrypting with %s returns error %v, want %s", c.name, err, c.want)
+		}
+	}
+}
+
+func TestEncryptFiles(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"log.zip.001", "log.zip.002"} {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, p)
+	}
+
+	// Nothing is removed or left behind when one of files can't be encrypted.
+	if got, err := EncryptFiles(append(files, filepath.Join(dir, "missing")), &recipientKey(t).PublicKey); err == nil || got != nil {
+		t.Errorf("EncryptFiles with missing file = %v, error %v", got, err)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("plaintext %s is removed although encryption failed", f)
+		}
+		if _, err := os.Stat(f + EncryptedFileSuffix); !os.IsNotExist(err) {
+			t.Errorf("encrypted %s is left although encryption failed", f)
+		}
+	}
+
+	encrypted, err := EncryptFiles(files, &recipientKey(t).PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encrypted) != len(files) {
+		t.Fatalf("EncryptFiles returns %v", encrypted)
+	}
+	for i, f := range files {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("plaintext %s isn't removed", f)
+		}
+		out := filepath.Join(dir, "decrypted")
+		if err := DecryptFile(encrypted[i], out, recipientKey(t)); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadFile(out); string(b) != filepath.Base(f) {
+			t.Errorf("%s is decrypted as %q", encrypted[i], b)
+		}
+	}
+}
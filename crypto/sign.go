@@ -0,0 +1,129 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CanonicalizeJSON re-encodes JSON with sorted keys and without insignificant spaces,
+// so signature does not depend on formatting of profile.
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	// Anything after the value is not covered by canonical form, so it must not exist.
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// SignProfile signs canonical JSON of profile, returns base64 encoded detached signature.
+func SignProfile(profile []byte, key ed25519.PrivateKey) ([]byte, error) {
+	canonical, err := CanonicalizeJSON(profile)
+	if err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(key, canonical)
+	return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// VerifyProfile verifies base64 encoded detached signature against canonical JSON of profile.
+func VerifyProfile(profile []byte, signature []byte, key ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return errors.New(fmt.Sprintf("signature is not base64 format, error=%s", err))
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return errors.New(fmt.Sprintf("invalid signature size %d", len(sig)))
+	}
+
+	canonical, err := CanonicalizeJSON(profile)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, canonical, sig) {
+		return errors.New("signature mismatch, profile may be tampered")
+	}
+	return nil
+}
+
+// ParseSigningPublicKey parses Ed25519 public key in PEM (PKIX), base64 of PKIX or raw 32 bytes key.
+func ParseSigningPublicKey(s []byte) (ed25519.PublicKey, error) {
+	raw, _, err := decodeKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(raw), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not Ed25519 key")
+	}
+	return pub, nil
+}
+
+// ParseSigningPrivateKey parses Ed25519 private key in PEM (PKCS8) format.
+func ParseSigningPrivateKey(s []byte) (ed25519.PrivateKey, error) {
+	raw, _, err := decodeKey(s)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not Ed25519 key")
+	}
+	return priv, nil
+}
+
+// GenerateSigningKey creates Ed25519 key pair, returns PEM encoded private key and public key.
+func GenerateSigningKey() ([]byte, []byte, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return privPEM, pubPEM, nil
+}
@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+)
+
+func TestCanonicalizeJSON(t *testing.T) {
+	cases := []struct {
+		data string
+		want string
+	}{
+		// Keys are sorted at every level, order of array is kept.
+		{`{"b":1,"a":{"d":[3,2,1],"c":null}}`, `{"a":{"c":null,"d":[3,2,1]},"b":1}`},
+		{"{\n  \"a\" : {\n    \"d\" : [ 3, 2, 1 ],\n    \"c\" : null\n  },\n  \"b\" : 1\n}\n", `{"a":{"c":null,"d":[3,2,1]},"b":1}`},
+		// Numbers are kept as written, big integers don't lose precision.
+		{`{"n":1.0,"e":1e3,"big":12345678901234567890,"neg":-0.5}`, `{"big":12345678901234567890,"e":1e3,"n":1.0,"neg":-0.5}`},
+		// Escaped and raw characters have same form, HTML characters aren't escaped.
+		{`{"s":"\u00e9\u4e2d\u003c\u0026>\/"}`, `{"s":"é中<&>/"}`},
+		{`{"s":"é中<&>/"}`, `{"s":"é中<&>/"}`},
+		{`{"s":"line\nbreak\u2028\"quoted\"\\"}`, `{"s":"line\nbreak\u2028\"quoted\"\\"}`},
+		{`[true,false,null,"x"]`, `[true,false,null,"x"]`},
+	}
+	for _, c := range cases {
+		got, err := CanonicalizeJSON([]byte(c.data))
+		if err != nil {
+			t.Errorf("CanonicalizeJSON(%s) returns error %s", c.data, err)
+			continue
+		}
+		if string(got) != c.want {
+			t.Errorf("CanonicalizeJSON(%s) = %s, want %s", c.data, got, c.want)
+		}
+		// Canonical form is stable.
+		if again, err := CanonicalizeJSON(got); err != nil || string(again) != string(got) {
+			t.Errorf("CanonicalizeJSON(%s) = %s, not stable", got, again)
+		}
+	}
+
+	for _, data := range []string{"", `{"a":`, `{"a":1} {"b":2}`, `{"a":1}x`} {
+		if got, err := CanonicalizeJSON([]byte(data)); err == nil {
+			t.Errorf("CanonicalizeJSON(%s) = %s, should return error", data, got)
+		}
+	}
+}
+
+func TestSignProfile(t *testing.T) {
+	privPEM, pubPEM, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ParseSigningPrivateKey(privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseSigningPublicKey(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := []byte(`{"tasks":[{"id":1,"action":"dump"}],"upload":{"backend":"http","url":"https://example.com"}}`)
+	sig, err := SignProfile(profile, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyProfile(profile, sig, pub); err != nil {
+		t.Errorf("signature of profile isn't verified, error %s", err)
+	}
+	// Formatting and trailing line break of signature file don't matter.
+	reformatted := []byte("{\n  \"upload\": {\"url\": \"https://example.com\", \"backend\": \"http\"},\n  \"tasks\": [{\"action\": \"dump\", \"id\": 1}]\n}")
+	if err := VerifyProfile(reformatted, append(sig, '\n'), pub); err != nil {
+		t.Errorf("signature of reformatted profile isn't verified, error %s", err)
+	}
+
+	// Public key in base64 of PKIX or raw bytes is accepted as well.
+	for _, s := range []string{base64.StdEncoding.EncodeToString(pub), string(pubPEM)} {
+		key, err := ParseSigningPublicKey([]byte(s))
+		if err != nil || !key.Equal(pub) {
+			t.Errorf("ParseSigningPublicKey(%q) = %x, error %v", s, key, err)
+		}
+	}
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name    string
+		profile string
+		sig     string
+		key     ed25519.PublicKey
+	}{
+		{"tampered value", `{"tasks":[{"id":1,"action":"dump"}],"upload":{"backend":"http","url":"https://evil.com"}}`, string(sig), pub},
+		{"added field", `{"tasks":[{"id":1,"action":"dump"}],"upload":{"backend":"http","url":"https://example.com","proxy":{}}}`, string(sig), pub},
+		{"appended value", string(profile) + `{"tasks":[]}`, string(sig), pub},
+		{"other key", string(profile), string(sig), otherPub},
+		{"truncated signature", string(profile), string(sig[:20]), pub},
+		{"invalid base64", string(profile), "!" + string(sig[1:]), pub},
+		{"invalid profile", "{", string(sig), pub},
+	}
+	for _, c := range cases {
+		if err := VerifyProfile([]byte(c.profile), []byte(c.sig), c.key); err == nil {
+			t.Errorf("profile with %s is verified", c.name)
+		}
+	}
+}
@@ -3,6 +3,7 @@ module scp_delegator
 go 1.14
 
 require (
+	github.com/Azure/azure-pipeline-go v0.2.3
 	github.com/Azure/azure-storage-blob-go v0.12.0
 	github.com/StackExchange/wmi v0.0.0-20190523213315-cbe66965904d // indirect
 	github.com/beevik/guid v0.0.0-20170504223318-d0ea8faecee0
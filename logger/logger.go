@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -40,6 +41,15 @@ func (l *LoggerWrapper) Open(){
 	})
 }
 
+// SetOutput redirects log to w instead of log file under output directory, e.g. in tests.
+func (l *LoggerWrapper) SetOutput(w io.Writer) {
+	if l.instance == nil {
+		l.instance = log.New(w, "", log.LstdFlags|log.Llongfile|log.Lmsgprefix)
+		return
+	}
+	l.instance.SetOutput(w)
+}
+
 func (l *LoggerWrapper) Close() {
 	err := l.file.Close()
 	if err != nil {
@@ -92,6 +102,10 @@ func (l *LoggerWrapper) LogError(fmt string, arg ...interface{}) {
 	l.getInstance().SetPrefix("[Error] ")
 	l.getInstance().Printf(fmt, arg...)
 }
+func (l *LoggerWrapper) LogWarning(fmt string, arg ...interface{}) {
+	l.getInstance().SetPrefix("[Warning] ")
+	l.getInstance().Printf(fmt, arg...)
+}
 func (l *LoggerWrapper) LogInfo(fmt string, arg ...interface{}) {
 	l.getInstance().SetPrefix("[Info] ")
 	l.getInstance().Printf(fmt, arg...)
@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"scp_delegator/config"
+	"scp_delegator/constant"
+	"scp_delegator/crypto"
 	"scp_delegator/logger"
 	"scp_delegator/task"
 	"scp_delegator/upload"
+	"scp_delegator/validation"
 	"scp_delegator/zip"
 )
 
@@ -14,22 +18,41 @@ func main() {
 	fmt.Println("Main start")
 	logger.Wrapper.LogInfo("Main Start")
 
-	//if mode != local_mode {
-	// Check parent sign
-	//}
+	mode := flag.String("mode", constant.ModeManaged, "running mode, profile signature is not verified in local mode of dev build")
+	flag.Parse()
+
+	// Profile must be signed unless running in local mode
+	config.VerifyProfileSignature = !allowLocalMode(*mode)
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 
+	config.RegisterValidator(validation.Validate)
 	cfg := config.ParseProfile()
+	if cfg == nil {
+		logger.Wrapper.LogError("Can't get valid profile, stop running")
+		return
+	}
+
+	// Extract tool bundles which needed by tasks
+	extractBundles(&ctx, cfg)
+
 	mgr, err := task.CreateTaskHandler(&ctx, cfg)
 	if err != nil {
 		logger.Wrapper.LogError("Can't initialize tasks manager with error %s", err.Error())
 		return
 	}
 
+	// Finish uploads which interrupted in previous run while tasks are running
+	resumed := make(chan struct{})
+	go func() {
+		defer close(resumed)
+		resumeUploads(&ctx, cfg)
+	}()
+
 	// Executor
 	mgr.Run()
+	<-resumed
 
 	// Compress & upload Log dir
 	compressAndUpload(&ctx, cfg, config.GetOutputDir())
@@ -47,11 +70,77 @@ func compressAndUpload(ctx *context.Context, cfg *config.Config, target string)
 		logger.Wrapper.LogFatal("[Main] Get error when compressing output directory, error=%s", err)
 		return
 	}
+	// Encrypting
+	if cfg.Upload.Encryption.RecipientPublicKey != "" {
+		key, err := crypto.LoadRecipientPublicKey(cfg.Upload.Encryption.RecipientPublicKey)
+		if err != nil {
+			logger.Wrapper.LogFatal("[Main] Get error when loading recipient public key, error=%s", err)
+			return
+		}
+		segments, err = crypto.EncryptFiles(segments, key)
+		if err != nil {
+			logger.Wrapper.LogFatal("[Main] Get error when encrypting compressed segments, error=%s", err)
+			return
+		}
+	}
 	// Uploading
-	results := upload.PutFilesToAzBlob(ctx, &cfg.Upload, segments)
+	results := upload.PutFiles(ctx, &cfg.Upload, segments)
+	for _, r := range results {
+		if r.Error != nil {
+			logger.Wrapper.LogError("Upload failed with error=%s", *r.Error)
+		}
+	}
+}
+
+func resumeUploads(ctx *context.Context, cfg *config.Config) {
+	results := upload.ResumePending(ctx, &cfg.Upload)
 	for _, r := range results {
 		if r.Error != nil {
-			logger.Wrapper.LogError("Upload failed with error=%s", r.Error)
+			logger.Wrapper.LogError("Resume upload failed with error=%s", *r.Error)
+		}
+	}
+}
+
+// allowLocalMode reports whether profile signature verification can be skipped in given mode,
+// it is only allowed by dev build which has no embedded public key.
+func allowLocalMode(mode string) bool {
+	if mode != constant.ModeLocal {
+		return false
+	}
+	if !constant.LocalModeAllowed {
+		logger.Wrapper.LogError("[Main] Local mode is only available in dev build, profile signature is still verified")
+		return false
+	}
+	if constant.ProfilePublicKey != "" {
+		logger.Wrapper.LogError("[Main] Local mode is refused since public key is embedded, profile signature is still verified")
+		return false
+	}
+	logger.Wrapper.LogWarning("[Main] Running in local mode, profile signature is NOT verified")
+	return true
+}
+
+func extractBundles(ctx *context.Context, cfg *config.Config) {
+	for _, b := range cfg.Bundles {
+		segments, err := zip.FindSegments(b.Archive)
+		if err != nil {
+			logger.Wrapper.LogError("[Main] Can't find bundle %s, error=%s", b.Archive, err)
+			continue
+		}
+
+		// Extracting into working directory would overwrite files of delegator itself.
+		dest := b.Destination
+		if dest == "" {
+			logger.Wrapper.LogError("[Main] Bundle %s has no destination, skip it", b.Archive)
+			continue
+		}
+		opts := &zip.DecompressOptions{
+			MaxTotalBytes: int64(b.MaxSizeMB) << 20,
+		}
+		files, err := zip.Decompress(ctx, segments, dest, opts)
+		if err != nil {
+			logger.Wrapper.LogError("[Main] Get error when extracting bundle %s, error=%s", b.Archive, err)
+			continue
 		}
+		logger.Wrapper.LogInfo("[Main] Bundle %s extracted %d files to %s", b.Archive, len(files), dest)
 	}
 }
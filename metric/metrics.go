@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/mem"
-	"github.com/shirou/gopsutil/process"
-	win "scp_delegator/system/windows"
-	"syscall"
+	"github.com/shirou/gopsutil/net"
+	"math"
+	"scp_delegator/system"
 	"time"
-	"unsafe"
 )
 
 func GetCoreCounts(logical bool) (int32, error) {
@@ -39,20 +40,24 @@ func GetCpuUsageCores() ([]float64, error) {
 	return ps, nil
 }
 
-func GetProcessCpuUsage(processName string) (float64,error) {
-	pid, err := win.GetPID(processName)
+// GetProcessCpuUsage returns average CPU usage of process since it started.
+func GetProcessCpuUsage(processName string) (float64, error) {
+	pid, err := system.GetPID(processName)
 	if err != nil {
 		return -1, errors.New(fmt.Sprintf("Error occurs when query PID with process %s, error=%s", processName, err.Error()))
 	}
-	proc, err := process.NewProcess(pid)
-	if err != nil {
-		return -1, errors.New(fmt.Sprintf("Error occurs when create process, error=%s", err.Error()))
-	}
-	percent, err := proc.CPUPercent()
+	percent, _, err := GetPIDCpuUsage(pid, nil)
+	return percent, err
+}
+
+// GetPIDCpuUsage returns CPU usage of process with given PID since last sample, and a new sample for next query.
+// If last is nil it returns average usage since process started.
+func GetPIDCpuUsage(pid int32, last *system.CPUSample) (float64, *system.CPUSample, error) {
+	percent, sample, err := system.GetProcessCpuPercent(pid, last)
 	if err != nil {
-		return -1, errors.New(fmt.Sprintf("Error occurs when get process CPU usage, error=%s", err.Error()))
+		return -1, nil, errors.New(fmt.Sprintf("Error occurs when get process CPU usage, PID=%d, error=%s", pid, err.Error()))
 	}
-	return percent, nil
+	return percent, sample, nil
 }
 
 func GetMemoryUsageByte() (int64,error) {
@@ -63,39 +68,30 @@ func GetMemoryUsageByte() (int64,error) {
 	return int64(v.Used),nil
 }
 
-type PROCESS_MEMORY_COUNTERS_EX struct {
-	cb                         uint32
-	PageFaultCount             uint32
-	PeakWorkingSetSize         uint64
-	WorkingSetSize             uint64
-	QuotaPeakPagedPoolUsage    uint64
-	QuotaPagedPoolUsage        uint64
-	QuotaPeakNonPagedPoolUsage uint64
-	QuotaNonPagedPoolUsage     uint64
-	PagefileUsage              uint64
-	PeakPagefileUsage          uint64
-	PrivateUsage               uint64
-}
-
 func GetProcessMemoryUsageByte(processName string) (int64, error) {
-	procHandle, err := win.OpenProcessHandle(processName)
+	pid, err := system.GetPID(processName)
 	if err != nil {
-		return -1, errors.New(fmt.Sprintf("Error occurs when open process %s failed, error=%s", processName, err.Error()))
+		return -1, errors.New(fmt.Sprintf("Error occurs when query PID with process %s, error=%s", processName, err.Error()))
 	}
-	defer syscall.CloseHandle(*procHandle)
+	return GetPIDMemoryUsageByte(pid)
+}
 
-	proc, err := win.GetAPI("Psapi.dll", "GetProcessMemoryInfo")
+// GetPIDMemoryUsageByte returns memory usage of process with given PID.
+func GetPIDMemoryUsageByte(pid int32) (int64, error) {
+	m, err := system.GetProcessMemoryInfo(pid)
 	if err != nil {
-		return -1, errors.New(fmt.Sprintf("Error occurs when get API failed, error=%s", err.Error()))
+		return -1, errors.New(fmt.Sprintf("Error occurs when get process memory usage, PID=%d, error=%s", pid, err.Error()))
 	}
+	return int64(m.Usage()), nil
+}
 
-	pmc := PROCESS_MEMORY_COUNTERS_EX{}
-	_, _, err = proc.Call(uintptr(*procHandle), uintptr(unsafe.Pointer(&pmc)), unsafe.Sizeof(pmc))
+// GetPIDMemoryUsageMB returns memory usage of process with given PID in MB.
+func GetPIDMemoryUsageMB(pid int32) (int64, error) {
+	m, err := GetPIDMemoryUsageByte(pid)
 	if err != nil {
-		return -1, errors.New(fmt.Sprintf("Error occurs when calling Windows API GetProcessMemoryInfo() failed, error %s", err.Error()))
+		return -1, err
 	}
-
-	return (int64)(pmc.PrivateUsage), nil
+	return m >> 20, nil
 }
 
 func GetProcessMemoryUsageMB(processName string) (int64,error) {
@@ -106,6 +102,15 @@ func GetProcessMemoryUsageMB(processName string) (int64,error) {
 	return m >> 20, nil
 }
 
+// GetPIDHandleCount returns count of handles or file descriptors opened by process with given PID.
+func GetPIDHandleCount(pid int32) (int64, error) {
+	count, err := system.GetProcessHandleCount(pid)
+	if err != nil {
+		return -1, errors.New(fmt.Sprintf("Error occurs when get process handle count, PID=%d, error=%s", pid, err.Error()))
+	}
+	return int64(count), nil
+}
+
 func GetMemoryUsageMB() (int64,error) {
 	m,err := GetMemoryUsageByte()
 	if err!=nil{
@@ -148,3 +153,191 @@ func GetDiskTotalGB(path string) (int64, error) {
 
 	return int64(usageStat.Total >> 30), nil
 }
+
+// CpuTimes is a sample of accumulated CPU times of whole machine or of each logical core.
+type CpuTimes []cpu.TimesStat
+
+// cpuBusyPercent returns busy percent of each CPU between two samples, same way as gopsutil computes it.
+// Zero sample of last gives average usage since boot.
+func cpuBusyPercent(last cpu.TimesStat, now cpu.TimesStat) float64 {
+	busy := func(t cpu.TimesStat) float64 {
+		return t.User + t.System + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	}
+	lastBusy, nowBusy := busy(last), busy(now)
+	lastAll, nowAll := lastBusy+last.Idle, nowBusy+now.Idle
+	if nowBusy <= lastBusy {
+		return 0
+	}
+	if nowAll <= lastAll {
+		return 100
+	}
+	return math.Min(100, (nowBusy-lastBusy)/(nowAll-lastAll)*100)
+}
+
+// getCpuPercentSince returns usage of each CPU since last sample and a new sample for next call.
+// If last is nil or count of CPUs changed, it returns average usage since boot.
+func getCpuPercentSince(percpu bool, last CpuTimes) ([]float64, CpuTimes, error) {
+	times, err := cpu.Times(percpu)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Error occurs when get CPU times, %s", err.Error()))
+	}
+	if len(times) == 0 {
+		return nil, nil, errors.New("Error occurs when get CPU times, no CPU found")
+	}
+	if len(last) != len(times) {
+		last = make(CpuTimes, len(times))
+	}
+	ps := make([]float64, len(times))
+	for i := range times {
+		ps[i] = cpuBusyPercent(last[i], times[i])
+	}
+	return ps, times, nil
+}
+
+// GetTotalCpuUsage returns CPU usage of whole machine since last sample and a new sample for next call.
+// If last is nil it returns average usage since boot.
+func GetTotalCpuUsage(last CpuTimes) (float64, CpuTimes, error) {
+	ps, times, err := getCpuPercentSince(false, last)
+	if err != nil {
+		return -1, nil, err
+	}
+	return ps[0], times, nil
+}
+
+// GetCpuCoreUsageMax returns usage of the busiest logical core since last sample and a new sample for next call.
+// If last is nil it returns average usage since boot.
+func GetCpuCoreUsageMax(last CpuTimes) (float64, CpuTimes, error) {
+	ps, times, err := getCpuPercentSince(true, last)
+	if err != nil {
+		return -1, nil, err
+	}
+	max := ps[0]
+	for _, p := range ps[1:] {
+		if p > max {
+			max = p
+		}
+	}
+	return max, times, nil
+}
+
+func GetMemoryAvailableMB() (int64, error) {
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		return -1, errors.New(fmt.Sprintf("Error occurs when get memory usage, error=%s", err.Error()))
+	}
+	return int64(v.Available >> 20), nil
+}
+
+func GetSwapUsageMB() (int64, error) {
+	s, err := mem.SwapMemory()
+	if err != nil {
+		return -1, errors.New(fmt.Sprintf("Error occurs when get swap usage, error=%s", err.Error()))
+	}
+	return int64(s.Used >> 20), nil
+}
+
+// GetLoadAverage returns load average of latest minute, it is emulated by processor queue length on Windows.
+func GetLoadAverage() (float64, error) {
+	avg, err := load.Avg()
+	if err != nil {
+		return -1, errors.New(fmt.Sprintf("Error occurs when get load average, error=%s", err.Error()))
+	}
+	return avg.Load1, nil
+}
+
+// GetDiskIOBytes returns accumulated bytes read from and written to disks.
+func GetDiskIOBytes() (uint64, error) {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Error occurs when get disk I/O counters, error=%s", err.Error()))
+	}
+	total := uint64(0)
+	for name, c := range counters {
+		// Partitions are counted by their disks already.
+		if system.IsPhysicalDisk(name) {
+			total += c.ReadBytes + c.WriteBytes
+		}
+	}
+	return total, nil
+}
+
+// GetNetworkIOBytes returns accumulated bytes sent and received by network interfaces except loopback.
+func GetNetworkIOBytes() (uint64, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Error occurs when get network interfaces, error=%s", err.Error()))
+	}
+	loopback := map[string]bool{}
+	for _, i := range interfaces {
+		for _, flag := range i.Flags {
+			if flag == "loopback" {
+				loopback[i.Name] = true
+			}
+		}
+	}
+
+	counters, err := net.IOCounters(true)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Error occurs when get network I/O counters, error=%s", err.Error()))
+	}
+	total := uint64(0)
+	for _, c := range counters {
+		if !loopback[c.Name] {
+			total += c.BytesSent + c.BytesRecv
+		}
+	}
+	return total, nil
+}
+
+// GetSystemHandleCount returns count of handles on Windows or file descriptors on Linux opened by all processes.
+func GetSystemHandleCount() (int64, error) {
+	count, err := system.GetSystemHandleCount()
+	if err != nil {
+		return -1, errors.New(fmt.Sprintf("Error occurs when get system handle count, error=%s", err.Error()))
+	}
+	return int64(count), nil
+}
+
+func GetMemoryTotalByte() (uint64, error) {
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Error occurs when get memory usage, error=%s", err.Error()))
+	}
+	return v.Total, nil
+}
+
+// GetMemoryAvailableByte returns available and total physical memory in bytes.
+func GetMemoryAvailableByte() (uint64, uint64, error) {
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("Error occurs when get memory usage, error=%s", err.Error()))
+	}
+	return v.Available, v.Total, nil
+}
+
+// GetSwapUsageByte returns used and total swap in bytes.
+func GetSwapUsageByte() (uint64, uint64, error) {
+	s, err := mem.SwapMemory()
+	if err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("Error occurs when get swap usage, error=%s", err.Error()))
+	}
+	return s.Used, s.Total, nil
+}
+
+// GetDiskFreeByte returns free and total bytes of volume which path belongs to.
+func GetDiskFreeByte(path string) (uint64, uint64, error) {
+	usageStat, err := getDiskUsageStat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return usageStat.Free, usageStat.Total, nil
+}
+
+// GetHostInfo returns host name, platform, kernel and boot time of the machine.
+func GetHostInfo() (*host.InfoStat, error) {
+	info, err := host.Info()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error occurs when get host information, error=%s", err.Error()))
+	}
+	return info, nil
+}
@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadSystemKeys returns sysctl values of key like "kernel.pid_max", or all values under prefix like "net.ipv4".
+func ReadSystemKeys(key string) (map[string]string, error) {
+	root := filepath.Join("/proc/sys", strings.ReplaceAll(key, ".", "/"))
+	values := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		// Write only entries have no read permission.
+		if info.IsDir() || info.Mode().Perm()&0444 == 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel("/proc/sys", path)
+		name := strings.ReplaceAll(rel, "/", ".")
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			values[name] = "<error: " + err.Error() + ">"
+			return nil
+		}
+		values[name] = strings.TrimSpace(string(b))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package system
+
+import (
+	"errors"
+	"runtime"
+)
+
+func ReadSystemKeys(key string) (map[string]string, error) {
+	return nil, errors.New("system keys are not supported on " + runtime.GOOS)
+}
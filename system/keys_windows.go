@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package system
+
+import (
+	"errors"
+	"scp_delegator/system/windows"
+	"strings"
+)
+
+// ReadSystemKeys returns values of registry key like `HKEY_LOCAL_MACHINE\SOFTWARE\TrendMicro`.
+func ReadSystemKeys(key string) (map[string]string, error) {
+	parts := strings.SplitN(strings.Trim(key, `\`), `\`, 2)
+	if len(parts) != 2 {
+		return nil, errors.New("registry key should be <category>\\<path>, got " + key)
+	}
+	return windows.ReadRegValues(strings.ToUpper(parts[0]), parts[1])
+}
@@ -0,0 +1,192 @@
+package system
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Process is platform neutral information of a running process.
+type Process struct {
+	PID     int32
+	PPID    int32
+	Name    string
+	Exe     string
+	Cmdline string
+}
+
+// MemoryInfo is memory usage of process in bytes, fields not supported by platform are zero.
+type MemoryInfo struct {
+	RSS     uint64
+	PSS     uint64
+	Private uint64
+}
+
+// Usage returns the most representative memory usage of platform,
+// private bytes on Windows, PSS on Linux and RSS if others not available.
+func (m *MemoryInfo) Usage() uint64 {
+	if m.Private > 0 {
+		return m.Private
+	}
+	if m.PSS > 0 {
+		return m.PSS
+	}
+	return m.RSS
+}
+
+// MatchName reports whether process name, executable or first argument of command line equals to name.
+func (p *Process) MatchName(name string) bool {
+	equal := func(a, b string) bool {
+		if runtime.GOOS == "windows" {
+			return strings.EqualFold(a, b)
+		}
+		return a == b
+	}
+
+	if equal(p.Name, name) {
+		return true
+	}
+	if p.Exe != "" && (equal(filepath.Base(p.Exe), name) || equal(p.Exe, name)) {
+		return true
+	}
+	if p.Cmdline != "" {
+		arg0 := strings.Fields(p.Cmdline)[0]
+		return equal(filepath.Base(arg0), name)
+	}
+	return false
+}
+
+// ProcessFilter selects processes, a process matches when it satisfies every non-empty field.
+type ProcessFilter struct {
+	Name    string
+	Path    string
+	Cmdline *regexp.Regexp
+	PPID    int32
+}
+
+func (f *ProcessFilter) needDetail() bool {
+	return f.Path != "" || f.Cmdline != nil
+}
+
+// Match reports whether process satisfies the filter.
+func (f *ProcessFilter) Match(p *Process) bool {
+	if f.Name != "" && !p.MatchName(f.Name) {
+		return false
+	}
+	if f.PPID > 0 && p.PPID != f.PPID {
+		return false
+	}
+	if f.Path != "" {
+		if p.Exe == "" {
+			return false
+		}
+		if runtime.GOOS == "windows" {
+			if !strings.EqualFold(filepath.Clean(p.Exe), filepath.Clean(f.Path)) {
+				return false
+			}
+		} else if filepath.Clean(p.Exe) != filepath.Clean(f.Path) {
+			return false
+		}
+	}
+	if f.Cmdline != nil && !f.Cmdline.MatchString(p.Cmdline) {
+		return false
+	}
+	return true
+}
+
+// FindProcesses returns all processes which match given filter.
+func FindProcesses(f *ProcessFilter) ([]Process, error) {
+	ps, err := Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]Process, 0, 1)
+	for _, p := range ps {
+		// Filter by cheap fields first, executable path and command line may need extra queries.
+		if f.Name != "" && !p.MatchName(f.Name) && !f.needDetail() {
+			continue
+		}
+		if f.PPID > 0 && p.PPID != f.PPID {
+			continue
+		}
+		if f.needDetail() {
+			p.FillDetail()
+		}
+		if f.Match(&p) {
+			matched = append(matched, p)
+		}
+	}
+	return matched, nil
+}
+
+// FindProcessesByName returns all processes which match given name.
+func FindProcessesByName(name string) ([]Process, error) {
+	ps, err := Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]Process, 0, 1)
+	for _, p := range ps {
+		if p.MatchName(name) {
+			matched = append(matched, p)
+		}
+	}
+	return matched, nil
+}
+
+// FindProcessByName returns first process which matches given name.
+func FindProcessByName(name string) (*Process, error) {
+	ps, err := FindProcessesByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, errors.New("can't find specific process by name " + name)
+	}
+	return &ps[0], nil
+}
+
+// GetPID returns ID of first process which matches given name.
+func GetPID(processName string) (int32, error) {
+	p, err := FindProcessByName(processName)
+	if err != nil {
+		return -1, err
+	}
+	return p.PID, nil
+}
+
+// CPUSample is accumulated CPU time of a process at a moment.
+type CPUSample struct {
+	CPUTime time.Duration
+	At      time.Time
+}
+
+// GetProcessCpuPercent returns CPU usage of process since last sample and a new sample for next call,
+// 100 percent equals to one core. If last is nil it returns average usage since process started.
+func GetProcessCpuPercent(pid int32, last *CPUSample) (float64, *CPUSample, error) {
+	cpuTime, err := GetProcessCPUTime(pid)
+	if err != nil {
+		return -1, nil, err
+	}
+	now := &CPUSample{CPUTime: cpuTime, At: time.Now()}
+
+	if last == nil || cpuTime < last.CPUTime {
+		// No previous sample or PID reused by another process.
+		created, err := GetProcessCreateTime(pid)
+		if err != nil {
+			return -1, nil, err
+		}
+		last = &CPUSample{CPUTime: 0, At: created}
+	}
+
+	wall := now.At.Sub(last.At)
+	if wall <= 0 {
+		return 0, now, nil
+	}
+	return float64(cpuTime-last.CPUTime) / float64(wall) * 100, now, nil
+}
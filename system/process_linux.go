@@ -0,0 +1,243 @@
+//go:build linux
+// +build linux
+
+package system
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	procDir = "/proc"
+	// USER_HZ of procfs, it is 100 on all mainstream architectures.
+	clockTicksPerSecond = 100
+)
+
+// Processes returns all processes by scanning procfs.
+func Processes() ([]Process, error) {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Process, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.ParseInt(e.Name(), 10, 32)
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		p, err := readProcess(int32(pid))
+		if err != nil {
+			// Process exited during scanning.
+			continue
+		}
+		results = append(results, *p)
+	}
+	return results, nil
+}
+
+func procPath(pid int32, name string) string {
+	return filepath.Join(procDir, strconv.Itoa(int(pid)), name)
+}
+
+func readProcess(pid int32) (*Process, error) {
+	stat, err := readStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Process{
+		PID:  pid,
+		PPID: int32(stat.ppid),
+		Name: stat.comm,
+	}
+
+	// comm is truncated to 15 characters, prefer full name from exe or cmdline.
+	if exe, err := os.Readlink(procPath(pid, "exe")); err == nil {
+		p.Exe = strings.TrimSuffix(exe, " (deleted)")
+	}
+	if cmdline, err := ioutil.ReadFile(procPath(pid, "cmdline")); err == nil {
+		p.Cmdline = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+	if p.Exe != "" && strings.HasPrefix(filepath.Base(p.Exe), p.Name) {
+		p.Name = filepath.Base(p.Exe)
+	}
+	return p, nil
+}
+
+type procStat struct {
+	comm      string
+	state     byte
+	ppid      int64
+	utime     uint64
+	stime     uint64
+	starttime uint64
+}
+
+// readStat parses /proc/<pid>/stat, comm is wrapped by parentheses and may contain spaces.
+func readStat(pid int32) (*procStat, error) {
+	s, err := ioutil.ReadFile(procPath(pid, "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	line := string(s)
+	begin := strings.IndexByte(line, '(')
+	end := strings.LastIndexByte(line, ')')
+	if begin < 0 || end < begin {
+		return nil, errors.New(fmt.Sprintf("invalid stat format of process %d", pid))
+	}
+
+	// Fields after comm start from state (field 3).
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 20 {
+		return nil, errors.New(fmt.Sprintf("invalid stat format of process %d", pid))
+	}
+	st := &procStat{comm: line[begin+1 : end], state: fields[0][0]}
+	st.ppid, _ = strconv.ParseInt(fields[1], 10, 64)
+	st.utime, _ = strconv.ParseUint(fields[11], 10, 64)
+	st.stime, _ = strconv.ParseUint(fields[12], 10, 64)
+	st.starttime, _ = strconv.ParseUint(fields[19], 10, 64)
+	return st, nil
+}
+
+// GetProcessCPUTime returns sum of user and system time of process.
+func GetProcessCPUTime(pid int32) (time.Duration, error) {
+	st, err := readStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(st.utime+st.stime) * time.Second / clockTicksPerSecond, nil
+}
+
+// GetProcessCreateTime returns start time of process, computed from boot time and start ticks.
+func GetProcessCreateTime(pid int32) (time.Time, error) {
+	st, err := readStat(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return boot.Add(time.Duration(st.starttime) * time.Second / clockTicksPerSecond), nil
+}
+
+func bootTime() (time.Time, error) {
+	f, err := os.Open(filepath.Join(procDir, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			sec, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, errors.New("can't find boot time in /proc/stat")
+}
+
+// GetProcessMemoryInfo returns RSS from status and PSS from smaps_rollup if kernel supports it.
+func GetProcessMemoryInfo(pid int32) (*MemoryInfo, error) {
+	m := &MemoryInfo{}
+	rss, err := readKBField(procPath(pid, "status"), "VmRSS:")
+	if err != nil {
+		return nil, err
+	}
+	m.RSS = rss
+
+	if pss, err := readKBField(procPath(pid, "smaps_rollup"), "Pss:"); err == nil {
+		m.PSS = pss
+	}
+	return m, nil
+}
+
+// readKBField returns value in bytes of line like "VmRSS:   1234 kB".
+func readKBField(path string, key string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == key {
+			v, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return v << 10, nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("can't find %s in %s", key, path))
+}
+
+// FillDetail is no-op on Linux because procfs scanning already reads executable path and command line.
+func (p *Process) FillDetail() {
+}
+
+// GetProcessHandleCount returns count of file descriptors opened by process.
+func GetProcessHandleCount(pid int32) (uint32, error) {
+	fds, err := ioutil.ReadDir(procPath(pid, "fd"))
+	if err != nil {
+		return 0, err
+	}
+	return uint32(len(fds)), nil
+}
+
+// IsProcessResponding reports whether process is runnable, process which is zombie, stopped
+// or in uninterruptible sleep is regarded as not responding.
+func IsProcessResponding(pid int32) (bool, error) {
+	st, err := readStat(pid)
+	if err != nil {
+		return false, err
+	}
+	switch st.state {
+	case 'Z', 'T', 't', 'D':
+		return false, nil
+	}
+	return true, nil
+}
+
+// GetSystemHandleCount returns count of file handles allocated by kernel.
+func GetSystemHandleCount() (uint32, error) {
+	s, err := ioutil.ReadFile(filepath.Join(procDir, "sys", "fs", "file-nr"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(s))
+	if len(fields) == 0 {
+		return 0, errors.New("invalid format of file-nr")
+	}
+	count, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(count), nil
+}
+
+// IsPhysicalDisk reports whether name is a whole disk rather than partition, loop or RAM device.
+func IsPhysicalDisk(name string) bool {
+	if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+		return false
+	}
+	_, err := os.Stat(filepath.Join("/sys/block", name))
+	return err == nil
+}
@@ -0,0 +1,114 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package system
+
+import (
+	"errors"
+	"github.com/shirou/gopsutil/process"
+	"runtime"
+	"time"
+)
+
+// Processes returns all processes by gopsutil on platforms without native implementation.
+func Processes() ([]Process, error) {
+	ps, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Process, 0, len(ps))
+	for _, proc := range ps {
+		p := Process{PID: proc.Pid}
+		p.PPID, _ = proc.Ppid()
+		p.Name, _ = proc.Name()
+		p.Exe, _ = proc.Exe()
+		p.Cmdline, _ = proc.Cmdline()
+		results = append(results, p)
+	}
+	return results, nil
+}
+
+// FillDetail is no-op because Processes already reads executable path and command line.
+func (p *Process) FillDetail() {
+}
+
+// GetProcessCPUTime returns sum of user and system time of process.
+func GetProcessCPUTime(pid int32) (time.Duration, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	t, err := proc.Times()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration((t.User + t.System) * float64(time.Second)), nil
+}
+
+// GetProcessCreateTime returns start time of process.
+func GetProcessCreateTime(pid int32) (time.Time, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := proc.CreateTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+// GetProcessMemoryInfo returns RSS of process.
+func GetProcessMemoryInfo(pid int32) (*MemoryInfo, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	m, err := proc.MemoryInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryInfo{RSS: m.RSS}, nil
+}
+
+// GetProcessHandleCount returns count of file descriptors opened by process.
+func GetProcessHandleCount(pid int32) (uint32, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	n, err := proc.NumFDs()
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
+
+// IsProcessResponding reports whether process is runnable, process which is zombie, stopped
+// or in uninterruptible sleep is regarded as not responding.
+func IsProcessResponding(pid int32) (bool, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return false, err
+	}
+	status, err := proc.Status()
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case "Z", "T", "D":
+		return false, nil
+	}
+	return true, nil
+}
+
+// GetSystemHandleCount is not supported on platforms without native implementation.
+func GetSystemHandleCount() (uint32, error) {
+	return 0, errors.New("system handle count is not supported on " + runtime.GOOS)
+}
+
+// IsPhysicalDisk reports whether I/O counters of name are not included by others.
+func IsPhysicalDisk(name string) bool {
+	return true
+}
@@ -0,0 +1,102 @@
+//go:build windows
+// +build windows
+
+package system
+
+import (
+	"github.com/shirou/gopsutil/process"
+	"path/filepath"
+	win "scp_delegator/system/windows"
+	"time"
+)
+
+// Processes returns all processes by Toolhelp32 snapshot.
+func Processes() ([]Process, error) {
+	ps, err := win.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Process, 0, len(ps))
+	for _, p := range ps {
+		results = append(results, Process{
+			PID:  int32(p.ProcessID),
+			PPID: int32(p.ParentProcessID),
+			Name: p.Exe,
+		})
+	}
+	return results, nil
+}
+
+// FillDetail queries executable path and command line which are not included in snapshot.
+func (p *Process) FillDetail() {
+	if exe, err := win.GetProcessImagePath(p.PID); err == nil {
+		p.Exe = exe
+	}
+	if proc, err := process.NewProcess(p.PID); err == nil {
+		if cmdline, err := proc.Cmdline(); err == nil {
+			p.Cmdline = cmdline
+		}
+	}
+	if p.Name == "" && p.Exe != "" {
+		p.Name = filepath.Base(p.Exe)
+	}
+}
+
+// GetProcessCPUTime returns sum of kernel and user time of process.
+func GetProcessCPUTime(pid int32) (time.Duration, error) {
+	return win.GetProcessCPUTime(pid)
+}
+
+// GetProcessCreateTime returns start time of process.
+func GetProcessCreateTime(pid int32) (time.Time, error) {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := proc.CreateTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+// GetProcessMemoryInfo returns working set and private bytes of process.
+func GetProcessMemoryInfo(pid int32) (*MemoryInfo, error) {
+	pmc, err := win.GetProcessMemoryCounters(pid)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryInfo{
+		RSS:     uint64(pmc.WorkingSetSize),
+		Private: uint64(pmc.PrivateUsage),
+	}, nil
+}
+
+// GetProcessHandleCount returns count of kernel object handles opened by process.
+func GetProcessHandleCount(pid int32) (uint32, error) {
+	return win.GetProcessHandleCount(pid)
+}
+
+// IsProcessResponding reports whether process still handles messages of its windows.
+func IsProcessResponding(pid int32) (bool, error) {
+	hung, err := win.IsProcessHung(pid)
+	if err != nil {
+		return false, err
+	}
+	return !hung, nil
+}
+
+// GetSystemHandleCount returns count of handles opened by all processes.
+func GetSystemHandleCount() (uint32, error) {
+	pi, err := win.GetPerformanceInfo()
+	if err != nil {
+		return 0, err
+	}
+	return pi.HandleCount, nil
+}
+
+// IsPhysicalDisk reports whether I/O counters of name are not included by others, counters are per volume on Windows.
+func IsPhysicalDisk(name string) bool {
+	return true
+}
@@ -1,11 +1,15 @@
+//go:build windows
+// +build windows
+
 package windows
 
 import (
 	"errors"
 	"golang.org/x/sys/windows"
-	"scp_delegator/logger"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -86,7 +90,6 @@ func newWindowsProcess(e *windows.ProcessEntry32) WindowsProcess {
 func GetPID(processName string) (int32, error){
 	proc, err :=findProcessByName(processName)
 	if err!=nil{
-		logger.Wrapper.LogError("Get PID failed with error %s", err.Error())
 		return -1, err
 	}
 
@@ -96,13 +99,11 @@ func GetPID(processName string) (int32, error){
 func OpenProcessHandle(processName string) (*syscall.Handle, error) {
 	wp, err := findProcessByName(processName)
 	if err != nil {
-		logger.Wrapper.LogError("Find process ID failed with error %s", err.Error())
 		return nil, err
 	}
 
 	h, err := syscall.OpenProcess(PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(wp.ProcessID))
 	if err != nil{
-		logger.Wrapper.LogError("Open process handle fail with error %s", err)
 		return nil, err
 	}
 
@@ -112,14 +113,193 @@ func OpenProcessHandle(processName string) (*syscall.Handle, error) {
 func GetAPI(dllName string, funcName string) (*syscall.LazyProc,error) {
 	entry := syscall.NewLazyDLL(dllName)
 	if entry == nil {
-		logger.Wrapper.LogError("Can't find system library %s", dllName)
 		return nil, errors.New("Can't find system library" + dllName)
 	}
 
 	proc :=entry.NewProc(funcName)
 	if proc == nil{
-		logger.Wrapper.LogError("Can't find function name %s in library %s", dllName)
 		return nil, errors.New("Can't find function name"+ funcName + "library" + dllName)
 	}
 	return proc, nil
 }
+
+// Processes returns snapshot of all running processes.
+func Processes() ([]WindowsProcess, error) {
+	return processes()
+}
+
+func openProcessByPID(pid int32) (windows.Handle, error) {
+	return windows.OpenProcess(PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+}
+
+// PROCESS_MEMORY_COUNTERS_EX fields of SIZE_T are pointer sized, so the layout matches on 32 bit Windows too.
+type PROCESS_MEMORY_COUNTERS_EX struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+	PrivateUsage               uintptr
+}
+
+// GetProcessMemoryCounters calls GetProcessMemoryInfo() of Psapi with process ID.
+func GetProcessMemoryCounters(pid int32) (*PROCESS_MEMORY_COUNTERS_EX, error) {
+	h, err := openProcessByPID(pid)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(h)
+
+	proc, err := GetAPI("Psapi.dll", "GetProcessMemoryInfo")
+	if err != nil {
+		return nil, err
+	}
+
+	pmc := PROCESS_MEMORY_COUNTERS_EX{}
+	pmc.cb = uint32(unsafe.Sizeof(pmc))
+	r, _, err := proc.Call(uintptr(h), uintptr(unsafe.Pointer(&pmc)), unsafe.Sizeof(pmc))
+	if r == 0 {
+		return nil, err
+	}
+	return &pmc, nil
+}
+
+// GetProcessCPUTime returns sum of kernel and user time of process.
+func GetProcessCPUTime(pid int32) (time.Duration, error) {
+	h, err := openProcessByPID(pid)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(h)
+
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	// Filetime counts in 100 nanoseconds.
+	ticks := uint64(kernel.HighDateTime)<<32 | uint64(kernel.LowDateTime)
+	ticks += uint64(user.HighDateTime)<<32 | uint64(user.LowDateTime)
+	return time.Duration(ticks * 100), nil
+}
+
+// GetProcessImagePath returns full path of process executable.
+func GetProcessImagePath(pid int32) (string, error) {
+	h, err := openProcessByPID(pid)
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(h)
+
+	proc, err := GetAPI("kernel32.dll", "QueryFullProcessImageNameW")
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	r, _, err := proc.Call(uintptr(h), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return "", err
+	}
+	return syscall.UTF16ToString(buf[:size]), nil
+}
+
+// GetProcessHandleCount returns count of handles opened by process.
+func GetProcessHandleCount(pid int32) (uint32, error) {
+	h, err := openProcessByPID(pid)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(h)
+
+	proc, err := GetAPI("kernel32.dll", "GetProcessHandleCount")
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint32
+	r, _, err := proc.Call(uintptr(h), uintptr(unsafe.Pointer(&count)))
+	if r == 0 {
+		return 0, err
+	}
+	return count, nil
+}
+
+// hungQuery is shared state of enumWindowsCallback, because callbacks created by syscall.NewCallback are never released.
+var hungQuery struct {
+	sync.Mutex
+	pid    uint32
+	hung   bool
+	isHung *syscall.LazyProc
+}
+
+var enumWindowsCallback = syscall.NewCallback(func(hwnd uintptr, lparam uintptr) uintptr {
+	var owner uint32
+	if _, err := windows.GetWindowThreadProcessId(windows.HWND(hwnd), &owner); err != nil || owner != hungQuery.pid {
+		return 1
+	}
+	if r, _, _ := hungQuery.isHung.Call(hwnd); r != 0 {
+		hungQuery.hung = true
+		// Stop enumeration
+		return 0
+	}
+	return 1
+})
+
+// IsProcessHung reports whether any top-level window of process stops responding to messages.
+// Process without window, like a service, is never hung.
+func IsProcessHung(pid int32) (bool, error) {
+	enumWindows, err := GetAPI("user32.dll", "EnumWindows")
+	if err != nil {
+		return false, err
+	}
+	isHung, err := GetAPI("user32.dll", "IsHungAppWindow")
+	if err != nil {
+		return false, err
+	}
+
+	hungQuery.Lock()
+	defer hungQuery.Unlock()
+	hungQuery.pid, hungQuery.hung, hungQuery.isHung = uint32(pid), false, isHung
+	// EnumWindows returns zero if callback stops enumeration, so its result is ignored.
+	enumWindows.Call(enumWindowsCallback, 0)
+	return hungQuery.hung, nil
+}
+
+type PERFORMANCE_INFORMATION struct {
+	cb                uint32
+	CommitTotal       uintptr
+	CommitLimit       uintptr
+	CommitPeak        uintptr
+	PhysicalTotal     uintptr
+	PhysicalAvailable uintptr
+	SystemCache       uintptr
+	KernelTotal       uintptr
+	KernelPaged       uintptr
+	KernelNonpaged    uintptr
+	PageSize          uintptr
+	HandleCount       uint32
+	ProcessCount      uint32
+	ThreadCount       uint32
+}
+
+// GetPerformanceInfo calls GetPerformanceInfo() of Psapi.
+func GetPerformanceInfo() (*PERFORMANCE_INFORMATION, error) {
+	proc, err := GetAPI("Psapi.dll", "GetPerformanceInfo")
+	if err != nil {
+		return nil, err
+	}
+
+	pi := PERFORMANCE_INFORMATION{}
+	pi.cb = uint32(unsafe.Sizeof(pi))
+	r, _, err := proc.Call(uintptr(unsafe.Pointer(&pi)), unsafe.Sizeof(pi))
+	if r == 0 {
+		return nil, err
+	}
+	return &pi, nil
+}
@@ -1,8 +1,14 @@
+//go:build windows
+// +build windows
+
 package windows
 
 import (
+	"encoding/hex"
 	"errors"
 	"golang.org/x/sys/windows/registry"
+	"strconv"
+	"strings"
 )
 
 var RegCategoryMap = map[string]registry.Key {
@@ -50,4 +56,49 @@ func QueryRegKey32(keyCategory string, keyPath string, key string )(string, erro
 		return "", err
 	}
 	return s, nil
-}
\ No newline at end of file
+}
+// ReadRegValues returns all values of registry key in text, key is opened for reading only.
+func ReadRegValues(keyCategory string, keyPath string) (map[string]string, error) {
+	cat, ok := RegCategoryMap[keyCategory]
+	if !ok {
+		return nil, errors.New("invalid key category")
+	}
+
+	r, err := registry.OpenKey(cat, keyPath, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	names, err := r.ReadValueNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		_, valType, err := r.GetValue(name, nil)
+		if err != nil {
+			continue
+		}
+		switch valType {
+		case registry.SZ, registry.EXPAND_SZ:
+			values[name], _, err = r.GetStringValue(name)
+		case registry.MULTI_SZ:
+			var s []string
+			s, _, err = r.GetStringsValue(name)
+			values[name] = strings.Join(s, "; ")
+		case registry.DWORD, registry.QWORD:
+			var n uint64
+			n, _, err = r.GetIntegerValue(name)
+			values[name] = strconv.FormatUint(n, 10)
+		default:
+			var b []byte
+			b, _, err = r.GetBinaryValue(name)
+			values[name] = hex.EncodeToString(b)
+		}
+		if err != nil {
+			values[name] = "<error: " + err.Error() + ">"
+		}
+	}
+	return values, nil
+}
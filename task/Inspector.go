@@ -4,10 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math"
 	"scp_delegator/config"
 	"scp_delegator/logger"
 	"scp_delegator/metric"
+	"scp_delegator/system"
 	"syscall"
 	"time"
 )
@@ -15,46 +15,167 @@ import (
 // =================================================
 // Add method at below if add new condition checker
 // =================================================
-type ConditionChecker func(string, *config.ConditionCriteria) (bool, error)
+type ConditionChecker func(*CheckContext, *config.ConditionCriteria) (*CheckResult, error)
 
-var ConditionCheckerMap = map[string]ConditionChecker{
-	"CPU":                ConditionCheckerCPU,
-	"Memory":             ConditionCheckerMemory,
-	"DiskAvailableUsage": ConditionCheckerDiskFreeSpace,
+// CheckContext carries monitored condition and states kept by inspector across polls.
+type CheckContext struct {
+	Condition *config.Condition
+	// History is nil unless condition has lifecycle criteria.
+	History *ProcessHistory
+
+	// states keeps per criterion states of stateful checkers.
+	states map[CriteriaID]interface{}
 }
 
-func ConditionCheckerCPU(processName string, c *config.ConditionCriteria) (bool, error) {
-	currentUsage, err := metric.GetProcessCpuUsage(processName)
+// State returns state of criterion, create is called to initialize it at the first time.
+func (ctx *CheckContext) State(c *config.ConditionCriteria, create func() (interface{}, error)) (interface{}, error) {
+	id := CriteriaID(c.ID)
+	if st, ok := ctx.states[id]; ok {
+		return st, nil
+	}
+	st, err := create()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	if ctx.states == nil {
+		ctx.states = make(map[CriteriaID]interface{})
+	}
+	ctx.states[id] = st
+	return st, nil
+}
 
-	return compareWithOperator(uint64(math.Ceil(currentUsage)), uint64(c.Threshold), c.Operator), nil
+var ConditionCheckerMap = map[string]ConditionChecker{
+	"CPU":                   ConditionCheckerCPU,
+	"Memory":                ConditionCheckerMemory,
+	"Handles":               ConditionCheckerHandles,
+	"ProcessStarted":        ConditionCheckerProcessStarted,
+	"ProcessExited":         ConditionCheckerProcessExited,
+	"ProcessRestarted":      ConditionCheckerProcessRestarted,
+	"ProcessAbsent":         ConditionCheckerProcessAbsent,
+	"ProcessNotResponding":  ConditionCheckerProcessNotResponding,
+	"LogPattern":            ConditionCheckerLogPattern,
+	"FileExists":            ConditionCheckerFileExists,
+	"FileAbsent":            ConditionCheckerFileAbsent,
+	"FileSize":              ConditionCheckerFileSize,
+	"DirectorySize":         ConditionCheckerDirectorySize,
+	"FileModified":          ConditionCheckerFileModified,
+	"FileCount":             ConditionCheckerFileCount,
+	"SystemCPU":             ConditionCheckerSystemCPU,
+	"SystemCPUCoreMax":      ConditionCheckerSystemCPUCoreMax,
+	"SystemMemoryAvailable": ConditionCheckerSystemMemoryAvailable,
+	"SystemSwapUsage":       ConditionCheckerSystemSwapUsage,
+	"SystemLoadAverage":     ConditionCheckerSystemLoadAverage,
+	"DiskIORate":            ConditionCheckerDiskIORate,
+	"NetworkThroughput":     ConditionCheckerNetworkThroughput,
+	"SystemHandles":         ConditionCheckerSystemHandles,
+	"TCPLatency":            ConditionCheckerTCPLatency,
+	"DNSResolution":         ConditionCheckerDNSResolution,
+	"HTTPStatus":            ConditionCheckerHTTPStatus,
+	"HTTPLatency":           ConditionCheckerHTTPLatency,
+	"DiskAvailableUsage":    ConditionCheckerDiskFreeSpace,
 }
 
-func ConditionCheckerMemory(processName string, c *config.ConditionCriteria) (bool, error) {
-	currentUsage, err := metric.GetProcessMemoryUsageMB(processName)
+// ConditionCheckerCPU keeps previous CPU sample of each process per criterion,
+// so criteria with different intervals measure their own periods.
+func ConditionCheckerCPU(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	// Usage of a process is 100 percent per core, percentage threshold is relative to all cores.
+	cores, err := metric.GetCoreCounts(true)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	st, err := ctx.State(c, func() (interface{}, error) {
+		return make(map[int32]*system.CPUSample), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	samples := st.(map[int32]*system.CPUSample)
+
+	sampled := make(map[int32]bool)
+	r, err := checkProcesses(ctx.Condition, c, float64(cores)*100, func(pid int32) (float64, error) {
+		currentUsage, sample, err := metric.GetPIDCpuUsage(pid, samples[pid])
+		if err != nil {
+			return 0, err
+		}
+		samples[pid] = sample
+		sampled[pid] = true
+		return currentUsage, nil
+	})
+	// Forget exited processes.
+	for pid := range samples {
+		if !sampled[pid] {
+			delete(samples, pid)
+		}
 	}
-	return compareWithOperator(uint64(currentUsage), uint64(c.Threshold), c.Operator), nil
+	return r, err
 }
 
-func ConditionCheckerDiskFreeSpace(processName string, c *config.ConditionCriteria) (bool, error) {
-	path, err := syscall.Getwd()
+func ConditionCheckerMemory(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	total, err := metric.GetMemoryTotalByte()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	currentUsage, err := metric.GetDiskFreeGB(path)
-	if err != nil {
-		return false, err
+	return checkProcesses(ctx.Condition, c, float64(total), func(pid int32) (float64, error) {
+		currentUsage, err := metric.GetPIDMemoryUsageByte(pid)
+		if err != nil {
+			return 0, err
+		}
+		return float64(currentUsage), nil
+	})
+}
+
+func ConditionCheckerHandles(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	return checkProcesses(ctx.Condition, c, 0, func(pid int32) (float64, error) {
+		count, err := metric.GetPIDHandleCount(pid)
+		if err != nil {
+			return 0, err
+		}
+		return float64(count), nil
+	})
+}
+
+// ConditionCheckerDiskFreeSpace checks free bytes of volumes of Paths, or of working directory if no path given.
+// It is satisfied if any volume is satisfied.
+func ConditionCheckerDiskFreeSpace(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	paths := c.Paths
+	if len(paths) == 0 {
+		path, err := syscall.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		paths = []string{path}
+	}
+
+	var r *CheckResult
+	for _, path := range paths {
+		free, total, err := metric.GetDiskFreeByte(path)
+		if err != nil {
+			return nil, err
+		}
+		r = capacityResult(float64(free), float64(total), c)
+		if r.Satisfied {
+			break
+		}
 	}
-	return compareWithOperator(uint64(currentUsage), uint64(c.Threshold), c.Operator), nil
+	return r, nil
 }
 
 // =================================================
 
-func compareWithOperator(value uint64, threshold uint64, operator string) bool {
+// Operators lists all comparison operators supported by compareWithOperator.
+var Operators = []string{">", ">=", "<", "<=", "!=", "==", "<>"}
+
+// IsValidOperator reports whether operator is supported by compareWithOperator.
+func IsValidOperator(operator string) bool {
+	for _, op := range Operators {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func compareWithOperator(value float64, threshold float64, operator string) bool {
 	if operator == ">" {
 		return value > threshold
 	} else if operator == ">=" {
@@ -84,7 +205,20 @@ type Inspector struct {
 	material      *config.ConditionMaterial
 	runAction		OnRunAction
 
-	lastCheckTime map[CriteriaID]uint64
+	nextCheckTime map[CriteriaID]time.Time
+	// maturing keeps deadline of criterion whose satisfied sample is confirmed again after maturity.
+	maturing      map[CriteriaID]time.Time
+	lastResults   map[CriteriaID]*CheckResult
+	windows       map[CriteriaID]*sampleWindow
+
+	checkContext  *CheckContext
+	expression    *Expression
+	// Process history and expression have due time like criteria, history is polled by pollInterval.
+	pollInterval  time.Duration
+	nextPollTime  time.Time
+	nextEvaluateTime time.Time
+	// initErr is reported by first validation, because inspector creation never fails.
+	initErr       error
 }
 
 func CreateInspector(ctx *context.Context, m *config.ConditionMaterial, runAction OnRunAction) *Inspector {
@@ -100,6 +234,39 @@ func CreateInspector(ctx *context.Context, m *config.ConditionMaterial, runActio
 }
 
 func (i *Inspector) init() {
+	i.nextCheckTime = make(map[CriteriaID]time.Time)
+	i.maturing = make(map[CriteriaID]time.Time)
+	i.lastResults = make(map[CriteriaID]*CheckResult)
+	i.windows = make(map[CriteriaID]*sampleWindow)
+	i.checkContext = &CheckContext{Condition: i.material.Condition}
+	if e := i.material.Condition.Expression; e != "" {
+		i.expression, i.initErr = ParseExpression(e)
+		if i.initErr != nil {
+			i.initErr = errors.New(fmt.Sprintf("invalid expression of condition ID=%d, error=%s", i.material.Condition.ID, i.initErr.Error()))
+		}
+	}
+	for _, c := range i.criteria() {
+		if c.Function != "" {
+			i.windows[CriteriaID(c.ID)] = newSampleWindow(c)
+		}
+	}
+	for _, c := range i.criteria() {
+		if lifecycleCriteria[c.Type] {
+			history, err := NewProcessHistory(i.material.Condition, lifecycleRetention(i.criteria()))
+			if err != nil {
+				i.initErr = err
+			}
+			i.checkContext.History = history
+			i.pollInterval = historyPollInterval(i.criteria())
+			break
+		}
+	}
+}
+
+func (i *Inspector) criteria() []*config.ConditionCriteria {
+	all := make([]*config.ConditionCriteria, 0, len(i.material.MandatoryCriteria)+len(i.material.OptionalCriteria))
+	all = append(all, i.material.MandatoryCriteria...)
+	return append(all, i.material.OptionalCriteria...)
 }
 
 func (i *Inspector) Start() error {
@@ -125,7 +292,13 @@ loop:
 					i.runAction()
 					break loop
 				}
-				time.Sleep(time.Millisecond * 1000)
+				// Sleep until the earliest criterion is due, cancellation wakes it up.
+				timer := time.NewTimer(i.nextCheckDelay())
+				select {
+				case <-i.ctx.Done():
+				case <-timer.C:
+				}
+				timer.Stop()
 			}
 		}
 	}
@@ -138,41 +311,184 @@ func (i *Inspector) Stop() {
 	i.cancelFunc()
 }
 
-func (i *Inspector) validateWithCriteria() (bool, error) {
-	compareWithSingleCriterion := func(c *config.ConditionCriteria) (bool, error) {
+// maxCheckDelay is the longest sleep of inspector before a criterion without sample is retried,
+// or when condition has nothing to check.
+const maxCheckDelay = time.Second
+
+// expressionInterval is pace of evaluating expression, which has no interval of its own,
+// the same as default interval of criteria.
+const expressionInterval = time.Second
+
+// historyPollInterval returns the shortest interval of lifecycle criteria, so process history
+// is as fresh as any of them needs.
+func historyPollInterval(criteria []*config.ConditionCriteria) time.Duration {
+	interval := time.Duration(0)
+	for _, c := range criteria {
+		if lifecycleCriteria[c.Type] && (interval == 0 || criterionInterval(c) < interval) {
+			interval = criterionInterval(c)
+		}
+	}
+	return interval
+}
+
+// nextCheckDelay returns time until the earliest criterion, process history poll or expression is due.
+func (i *Inspector) nextCheckDelay() time.Duration {
+	var next time.Time
+	due := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	if i.expression != nil {
+		if i.nextEvaluateTime.IsZero() {
+			return 0
+		}
+		due(i.nextEvaluateTime)
+	} else {
+		for _, c := range i.criteria() {
+			t, ok := i.nextCheckTime[CriteriaID(c.ID)]
+			if !ok {
+				return 0
+			}
+			due(t)
+		}
+		if i.checkContext.History != nil {
+			if i.nextPollTime.IsZero() {
+				return 0
+			}
+			due(i.nextPollTime)
+		}
+	}
+	if next.IsZero() {
+		return maxCheckDelay
+	}
+
+	delay := time.Until(next)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// sampleCriteria samples every criterion which is due. A satisfied sample of criterion with maturity
+// is confirmed by another sample at its maturity deadline, other criteria are sampled meanwhile.
+func (i *Inspector) sampleCriteria() error {
+	// Lifecycle criteria read events of the latest poll of process history.
+	if now := time.Now(); i.checkContext.History != nil && !now.Before(i.nextPollTime) {
+		if err := i.checkContext.History.Poll(now); err != nil {
+			return err
+		}
+		i.nextPollTime = now.Add(i.pollInterval)
+	}
+
+	for _, c := range i.criteria() {
+		id := CriteriaID(c.ID)
+		now := time.Now()
+		if due, ok := i.nextCheckTime[id]; ok && now.Before(due) {
+			continue
+		}
+
 		checker := ConditionCheckerMap[c.Type]
 		if checker == nil {
-			return false, errors.New(fmt.Sprintf("invalid criteria, type=%s, ID=%d", c.Type, c.ID))
+			return errors.New(fmt.Sprintf("invalid criteria, type=%s, ID=%d", c.Type, c.ID))
 		}
-
-		isSatisfied, err := checker(i.material.Condition.TargetProcess, c)
+		result, err := checker(i.checkContext, c)
 		if err != nil {
-			return false, err
-		} else if !isSatisfied {
-			return false, nil
+			return err
+		}
+		if result == nil {
+			// No sample yet, e.g. background probe is still running.
+			i.nextCheckTime[id] = now.Add(minDuration(criterionInterval(c), maxCheckDelay))
+			continue
 		}
+		i.nextCheckTime[id] = now.Add(criterionInterval(c))
 
-		if c.MaturityMS > 0 {
-			// Wait for maturity
-			time.Sleep(time.Duration(c.MaturityMS) * time.Millisecond)
-			// Validate again
-			isSatisfied, err = checker(i.material.Condition.TargetProcess, c)
-			if err != nil {
-				return false, err
-			} else if !isSatisfied {
-				return false, nil
-			}
+		if w := i.windows[id]; w != nil {
+			w.push(now, result.Value)
+		} else if _, ok := i.maturing[id]; ok {
+			// Maturity deadline reached, the confirming sample decides.
+			delete(i.maturing, id)
+		} else if result.Satisfied && c.MaturityMS > 0 {
+			// Keep previous result until the sample is confirmed.
+			deadline := now.Add(time.Duration(c.MaturityMS) * time.Millisecond)
+			i.maturing[id] = deadline
+			i.nextCheckTime[id] = deadline
+			continue
 		}
-		return true, nil
+		i.lastResults[id] = result
+	}
+	return nil
+}
+
+func minDuration(a time.Duration, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// isSatisfied evaluates criterion by its latest sample, or by window function over its samples.
+func (i *Inspector) isSatisfied(c *config.ConditionCriteria) bool {
+	id := CriteriaID(c.ID)
+	result := i.lastResults[id]
+	if result == nil {
+		return false
+	}
+
+	w := i.windows[id]
+	if w == nil {
+		return result.Satisfied
+	}
+	value, ready := w.evaluate()
+	if !ready {
+		return false
+	}
+	return satisfy(value, result.Total, c)
+}
+
+func (i *Inspector) logSatisfied(c *config.ConditionCriteria) {
+	id := CriteriaID(c.ID)
+	result := i.lastResults[id]
+	value := result.Value
+	if w := i.windows[id]; w != nil {
+		value, _ = w.evaluate()
+	}
+
+	if result.PID > 0 {
+		logger.Wrapper.LogInfo("Criterion satisfied, type=%s, ID=%d, function=%s, PID=%d, value=%.2f, threshold=%s", c.Type, c.ID, c.Function, result.PID, value, c.Threshold)
+	} else {
+		logger.Wrapper.LogInfo("Criterion satisfied, type=%s, ID=%d, function=%s, processes=%d, value=%.2f, threshold=%s", c.Type, c.ID, c.Function, result.Processes, value, c.Threshold)
+	}
+}
+
+func (i *Inspector) validateWithExpression() (bool, error) {
+	i.nextEvaluateTime = time.Now().Add(expressionInterval)
+	satisfied, hits, err := i.expression.Evaluate(i.material.Condition)
+	if err != nil || !satisfied {
+		return false, err
+	}
+	logger.Wrapper.LogInfo("Expression satisfied, condition ID=%d, expression=%s", i.material.Condition.ID, i.expression)
+	for _, hit := range hits {
+		logger.Wrapper.LogInfo("Expression hit %s", hit)
+	}
+	return true, nil
+}
+
+func (i *Inspector) validateWithCriteria() (bool, error) {
+	if i.initErr != nil {
+		return false, i.initErr
+	} else if i.expression != nil {
+		return i.validateWithExpression()
+	}
+
+	// Sample all criteria before evaluation, so windows keep filling even some criteria are not satisfied.
+	if err := i.sampleCriteria(); err != nil {
+		return false, err
 	}
 
 	// Check for each mandatory criteria
 	for _, mc := range i.material.MandatoryCriteria {
-		result, err:=compareWithSingleCriterion(mc)
-		if err !=nil{
-			return false, err
-		}
-		if !result {
+		if !i.isSatisfied(mc) {
 			// Early return because one of mandatory not satisfied.
 			return false, nil
 		}
@@ -180,15 +496,14 @@ func (i *Inspector) validateWithCriteria() (bool, error) {
 
 	// Check whether hit any optional criteria
 	for _, oc := range i.material.OptionalCriteria {
-		result, err:=compareWithSingleCriterion(oc)
-		if err !=nil {
-			return false, err
-		}
-		if result {
+		if i.isSatisfied(oc) {
 			// Satisfied to all needed conditions
+			for _, mc := range i.material.MandatoryCriteria {
+				i.logSatisfied(mc)
+			}
+			i.logSatisfied(oc)
 			return true, nil
 		}
-
 	}
 
 	return false, nil
@@ -0,0 +1,165 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"testing"
+	"time"
+)
+
+func newTestInspector(mandatory []*config.ConditionCriteria, optional []*config.ConditionCriteria) *Inspector {
+	i := &Inspector{material: &config.ConditionMaterial{
+		Condition:         &config.Condition{ID: 1},
+		MandatoryCriteria: mandatory,
+		OptionalCriteria:  optional,
+	}}
+	i.init()
+	return i
+}
+
+func fileExistsCriterion(id uint32, path string, maturityMS uint32) *config.ConditionCriteria {
+	return &config.ConditionCriteria{
+		ID:         id,
+		Type:       "FileExists",
+		Interval:   5,
+		Operator:   "==",
+		Threshold:  config.Threshold{Value: 1},
+		MaturityMS: maturityMS,
+		Paths:      []string{path},
+	}
+}
+
+func TestInspectorMaturity(t *testing.T) {
+	useTestLog(t)
+	dir := t.TempDir()
+	flag := filepath.Join(dir, "flag")
+	if err := ioutil.WriteFile(flag, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mature := fileExistsCriterion(1, flag, 300)
+	other := fileExistsCriterion(2, flag, 0)
+	i := newTestInspector([]*config.ConditionCriteria{mature}, []*config.ConditionCriteria{other})
+
+	start := time.Now()
+	hit, err := i.validateWithCriteria()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("maturity blocks sampling for %s", elapsed)
+	}
+	if hit || i.isSatisfied(mature) {
+		t.Error("criterion is satisfied before maturity")
+	}
+	if !i.isSatisfied(other) {
+		t.Error("criterion without maturity isn't sampled while other one matures")
+	}
+	if delay := i.nextCheckDelay(); delay <= 0 || delay > 300*time.Millisecond {
+		t.Errorf("next check delay is %s, want maturity deadline", delay)
+	}
+
+	time.Sleep(i.nextCheckDelay())
+	if hit, err = i.validateWithCriteria(); err != nil || !hit {
+		t.Errorf("condition isn't satisfied after maturity, error %v", err)
+	}
+	// Criteria are sampled again by their interval.
+	if delay := i.nextCheckDelay(); delay < 4*time.Second {
+		t.Errorf("next check delay is %s, want interval", delay)
+	}
+}
+
+func TestInspectorMaturityNotConfirmed(t *testing.T) {
+	useTestLog(t)
+	dir := t.TempDir()
+	flag := filepath.Join(dir, "flag")
+	if err := ioutil.WriteFile(flag, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := fileExistsCriterion(1, flag, 100)
+	i := newTestInspector([]*config.ConditionCriteria{c}, nil)
+
+	if err := i.sampleCriteria(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(flag); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(i.nextCheckDelay())
+	if err := i.sampleCriteria(); err != nil {
+		t.Fatal(err)
+	}
+	if i.isSatisfied(c) {
+		t.Error("criterion is satisfied although it isn't confirmed at maturity deadline")
+	}
+	if _, ok := i.maturing[CriteriaID(c.ID)]; ok {
+		t.Error("maturity isn't cleared after confirming sample")
+	}
+}
+
+// useCountedCriterion registers criteria type "Counted" which counts samples of each criterion and is never satisfied.
+func useCountedCriterion(t *testing.T) map[uint32]int {
+	samples := make(map[uint32]int)
+	ConditionCheckerMap["Counted"] = func(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+		samples[c.ID]++
+		return &CheckResult{}, nil
+	}
+	t.Cleanup(func() {
+		delete(ConditionCheckerMap, "Counted")
+	})
+	return samples
+}
+
+func TestInspectorCriteriaCadence(t *testing.T) {
+	useTestLog(t)
+	samples := useCountedCriterion(t)
+	fast := &config.ConditionCriteria{ID: 1, Type: "Counted", Interval: 1}
+	slow := &config.ConditionCriteria{ID: 2, Type: "Counted", Interval: 3}
+	i := newTestInspector([]*config.ConditionCriteria{fast, slow}, nil)
+
+	// Inspector wakes up only when a criterion is due, at 0s, 1s and 2s, and next at 3s.
+	wakeups := 0
+	for start := time.Now(); time.Since(start) < 2500*time.Millisecond; time.Sleep(i.nextCheckDelay()) {
+		if err := i.sampleCriteria(); err != nil {
+			t.Fatal(err)
+		}
+		wakeups++
+	}
+	if samples[fast.ID] != 3 || samples[slow.ID] != 1 || wakeups != 3 {
+		t.Errorf("criteria of 1s and 3s intervals are sampled %d and %d times in %d wakeups, want 3 and 1 in 3 wakeups",
+			samples[fast.ID], samples[slow.ID], wakeups)
+	}
+}
+
+func TestInspectorHistoryAndExpressionCadence(t *testing.T) {
+	useTestLog(t)
+	absent := &config.ConditionCriteria{ID: 1, Type: "ProcessAbsent", Interval: 3, Operator: "==", Threshold: config.Threshold{Value: 1}}
+	i := &Inspector{material: &config.ConditionMaterial{
+		Condition:         &config.Condition{ID: 1, TargetProcess: "scp-no-such-process"},
+		MandatoryCriteria: []*config.ConditionCriteria{absent},
+	}}
+	i.init()
+	if i.checkContext.History == nil || i.pollInterval != 3*time.Second {
+		t.Fatalf("process history is polled every %s, want interval of lifecycle criterion", i.pollInterval)
+	}
+	if err := i.sampleCriteria(); err != nil {
+		t.Fatal(err)
+	}
+	if delay := i.nextCheckDelay(); delay < 2500*time.Millisecond {
+		t.Errorf("next check delay with process history is %s, want interval of 3s", delay)
+	}
+
+	i = newTestInspector(nil, nil)
+	i.material.Condition.Expression = "file_exists('scp-no-such-file')"
+	i.init()
+	if delay := i.nextCheckDelay(); delay != 0 {
+		t.Errorf("expression isn't due before the first evaluation, delay %s", delay)
+	}
+	if hit, err := i.validateWithCriteria(); err != nil || hit {
+		t.Fatalf("expression returns %v, error %v", hit, err)
+	}
+	if delay := i.nextCheckDelay(); delay < expressionInterval-100*time.Millisecond {
+		t.Errorf("next check delay with expression is %s, want %s", delay, expressionInterval)
+	}
+}
@@ -0,0 +1,214 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"scp_delegator/config"
+	"scp_delegator/constant"
+	"sort"
+	"strings"
+)
+
+// Action kinds
+const (
+	ActionKindEmbedded = "embedded"
+	ActionKindExec     = "exec"
+)
+
+type commandBuilder func(ctx context.Context, action *config.Action) (*exec.Cmd, error)
+
+// ActionCommandBuilderMap builds command of action by kind of action, empty kind is embedded.
+var ActionCommandBuilderMap = map[string]commandBuilder{
+	ActionKindEmbedded: buildEmbeddedCommand,
+	ActionKindExec:     buildExecCommand,
+}
+
+// IsValidActionKind returns true if action kind is empty, registered command kind or native kind.
+func IsValidActionKind(kind string) bool {
+	if kind == "" {
+		return true
+	}
+	if _, ok := NativeActionMap[kind]; ok {
+		return true
+	}
+	_, ok := ActionCommandBuilderMap[kind]
+	return ok
+}
+
+func actionKind(action *config.Action) string {
+	if action.Kind == "" {
+		return ActionKindEmbedded
+	}
+	return action.Kind
+}
+
+func buildCommand(ctx context.Context, action *config.Action) (*exec.Cmd, error) {
+	build, ok := ActionCommandBuilderMap[actionKind(action)]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown action kind %s, ID=%d", action.Kind, action.ID))
+	}
+	return build(ctx, action)
+}
+
+// buildEmbeddedCommand runs executor with option of embedded tool and arguments of action.
+func buildEmbeddedCommand(ctx context.Context, action *config.Action) (*exec.Cmd, error) {
+	innerArg, err := composeInnerArguments(action)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, composeBinaryPath(), composeArgument(action), innerArg)
+	return cmd, nil
+}
+
+// buildExecCommand runs allow-listed executable of action directly, each command and value of arguments is
+// passed as a separate argument unless raw command line is required.
+func buildExecCommand(ctx context.Context, action *config.Action) (*exec.Cmd, error) {
+	path, err := ResolveExecutable(action.Executable, action.WorkingDir)
+	if err != nil {
+		return nil, err
+	}
+	if !IsAllowedExecutable(path) {
+		return nil, errors.New(fmt.Sprintf("executable %s is not allowed", path))
+	}
+
+	cmd := exec.CommandContext(ctx, path)
+	if err := setCommandLine(cmd, action); err != nil {
+		return nil, err
+	}
+	cmd.Dir = action.WorkingDir
+	if len(action.Env) > 0 {
+		cmd.Env = mergeEnv(os.Environ(), action.Env)
+	}
+	return cmd, nil
+}
+
+// ResolveExecutable returns path of executable which is an absolute path, a path relative to working directory,
+// or a name looked up in PATH.
+func ResolveExecutable(name string, workingDir string) (string, error) {
+	if name == "" {
+		return "", errors.New("executable is empty")
+	}
+
+	path := name
+	if !filepath.IsAbs(name) {
+		if !strings.ContainsAny(name, `/\`) {
+			p, err := exec.LookPath(name)
+			if err != nil {
+				return "", errors.New(fmt.Sprintf("can't find executable %s in PATH, error=%s", name, err.Error()))
+			}
+			return filepath.Abs(p)
+		}
+		path = filepath.Join(workingDir, name)
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("can't find executable %s, error=%s", path, err.Error()))
+	}
+	if info.IsDir() {
+		return "", errors.New(fmt.Sprintf("executable %s is a directory", path))
+	}
+	return path, nil
+}
+
+// allowedExecutables returns AllowedExecutables with entries given in build time.
+func allowedExecutables() []string {
+	results := append([]string{}, constant.AllowedExecutables...)
+	for _, e := range strings.Split(constant.ExtraAllowedExecutables, ";") {
+		if e = strings.TrimSpace(e); e != "" {
+			results = append(results, e)
+		}
+	}
+	return results
+}
+
+// IsAllowedExecutable checks resolved executable with allow-list. An entry with directory must equal to the path,
+// an entry of bare name only allows the program which the name resolves to in PATH, not a copy placed elsewhere.
+func IsAllowedExecutable(path string) bool {
+	for _, e := range allowedExecutables() {
+		if !strings.ContainsAny(e, `/\`) {
+			resolved, err := ResolveExecutable(e, "")
+			if err != nil {
+				continue
+			}
+			e = resolved
+		}
+		if equalPath(filepath.Clean(e), filepath.Clean(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsListedExecutable checks executable of profile before it is resolved on target machine. A bare name must be
+// listed, a path must be listed or have a listed base name, which is checked again by IsAllowedExecutable when run.
+func IsListedExecutable(name string) bool {
+	hasDir := strings.ContainsAny(name, `/\`)
+	for _, e := range allowedExecutables() {
+		if strings.ContainsAny(e, `/\`) {
+			if hasDir && equalPath(filepath.Clean(e), filepath.Clean(name)) {
+				return true
+			}
+		} else if equalPath(e, filepath.Base(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalPath compares paths case insensitively on Windows.
+func equalPath(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// mergeEnv overrides environment variables of base by env, names are case insensitive on Windows.
+func mergeEnv(base []string, env map[string]string) []string {
+	normalize := func(s string) string { return s }
+	if runtime.GOOS == "windows" {
+		normalize = strings.ToUpper
+	}
+
+	results := make([]string, 0, len(base)+len(env))
+	for _, kv := range base {
+		if kv == "" {
+			continue
+		}
+		name := kv
+		if i := strings.Index(kv[1:], "="); i >= 0 {
+			// Windows keeps variables like "=C:" whose name starts with equal sign.
+			name = kv[:i+1]
+		}
+		overridden := false
+		for key := range env {
+			if normalize(key) == normalize(name) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			results = append(results, kv)
+		}
+	}
+
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		results = append(results, key+"="+env[key])
+	}
+	return results
+}
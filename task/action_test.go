@@ -0,0 +1,73 @@
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"scp_delegator/constant"
+	"strings"
+	"testing"
+)
+
+// writeTestExecutable creates executable file named name in dir.
+func writeTestExecutable(t *testing.T, dir string, name string) string {
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestIsAllowedExecutable(t *testing.T) {
+	name := "scp_test_tool"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	inPath := writeTestExecutable(t, t.TempDir(), name)
+	elsewhere := writeTestExecutable(t, t.TempDir(), name)
+	listed := writeTestExecutable(t, t.TempDir(), "listed_tool")
+	t.Setenv("PATH", filepath.Dir(inPath))
+
+	extra := constant.ExtraAllowedExecutables
+	constant.ExtraAllowedExecutables = name + ";" + listed
+	defer func() { constant.ExtraAllowedExecutables = extra }()
+
+	resolved, err := ResolveExecutable(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{resolved, true},
+		{filepath.Join(filepath.Dir(inPath), ".", name), true},
+		// Copy with listed name outside PATH is refused.
+		{elsewhere, false},
+		{listed, true},
+		{filepath.Join(filepath.Dir(elsewhere), "listed_tool"), false},
+		{writeTestExecutable(t, filepath.Dir(inPath), "other_tool"), false},
+	}
+	for _, c := range cases {
+		if got := IsAllowedExecutable(c.path); got != c.want {
+			t.Errorf("IsAllowedExecutable(%s) = %v, want %v", c.path, got, c.want)
+		}
+	}
+
+	listedCases := []struct {
+		name string
+		want bool
+	}{
+		{name, true},
+		{elsewhere, true},
+		{listed, true},
+		{"listed_tool", false},
+		{"other_tool", false},
+		{strings.TrimSuffix(listed, "listed_tool") + "other_tool", false},
+	}
+	for _, c := range listedCases {
+		if got := IsListedExecutable(c.name); got != c.want {
+			t.Errorf("IsListedExecutable(%s) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"scp_delegator/config"
+	"scp_delegator/system"
+)
+
+// Aggregation modes decide how metrics of all matched processes are combined.
+const (
+	AggregationSum = "sum"
+	AggregationMax = "max"
+	AggregationAny = "any"
+	AggregationAll = "all"
+)
+
+// Aggregations lists all supported aggregation modes, empty mode equals to AggregationAny.
+var Aggregations = []string{AggregationSum, AggregationMax, AggregationAny, AggregationAll}
+
+// IsValidAggregation reports whether mode is supported by checkProcesses.
+func IsValidAggregation(mode string) bool {
+	if mode == "" {
+		return true
+	}
+	for _, a := range Aggregations {
+		if a == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckResult is outcome of a condition checker.
+type CheckResult struct {
+	Satisfied bool
+	// PID is the process which tripped the criterion, 0 if result is not bound to single process.
+	PID   int32
+	Value float64
+	// Total is capacity in unit of Value, 0 if percentage is not applicable.
+	Total float64
+	// Processes is count of processes took part in the check.
+	Processes int
+}
+
+type processSampler func(pid int32) (float64, error)
+
+// NewProcessFilter composes process filter from monitor fields of condition.
+func NewProcessFilter(cond *config.Condition) (*system.ProcessFilter, error) {
+	f := &system.ProcessFilter{
+		Name: cond.TargetProcess,
+		Path: cond.TargetPath,
+		PPID: int32(cond.TargetParentID),
+	}
+	if cond.TargetCmdline != "" {
+		re, err := regexp.Compile(cond.TargetCmdline)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid command line pattern %s, error=%s", cond.TargetCmdline, err.Error()))
+		}
+		f.Cmdline = re
+	}
+	if f.Name == "" && f.Path == "" && f.Cmdline == nil && f.PPID == 0 {
+		return nil, errors.New(fmt.Sprintf("no monitor process given, condition ID=%d", cond.ID))
+	}
+	return f, nil
+}
+
+func findTargetProcesses(cond *config.Condition) ([]system.Process, error) {
+	f, err := NewProcessFilter(cond)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := system.FindProcesses(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, errors.New(fmt.Sprintf("can't find any process matches condition ID=%d", cond.ID))
+	}
+	return ps, nil
+}
+
+// checkProcesses samples every matched process and combines them by aggregation mode of condition,
+// total is capacity of a single process in unit of sampled values.
+func checkProcesses(cond *config.Condition, c *config.ConditionCriteria, total float64, sample processSampler) (*CheckResult, error) {
+	ps, err := findTargetProcesses(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	type pidValue struct {
+		pid   int32
+		value float64
+	}
+	values := make([]pidValue, 0, len(ps))
+	for _, p := range ps {
+		v, sampleErr := sample(p.PID)
+		if sampleErr != nil {
+			// Process may exit between enumerating and sampling.
+			err = sampleErr
+			continue
+		}
+		values = append(values, pidValue{pid: p.PID, value: v})
+	}
+	if len(values) == 0 {
+		return nil, err
+	}
+
+	// Reduce to single value so that result can also be sampled into window of criterion.
+	// Mode any picks value most favourable to operator, and mode all picks the least favourable one.
+	r := &CheckResult{Processes: len(values), Total: total}
+	switch cond.Aggregation {
+	case AggregationSum:
+		for _, v := range values {
+			r.Value += v.value
+		}
+	case AggregationMax:
+		top := values[0]
+		for _, v := range values[1:] {
+			if v.value > top.value {
+				top = v
+			}
+		}
+		r.PID, r.Value = top.pid, top.value
+	case AggregationAll:
+		picked := values[0]
+		for _, v := range values[1:] {
+			if isMoreFavourable(picked.value, v.value, c.Operator) || (satisfy(picked.value, total, c) && !satisfy(v.value, total, c)) {
+				picked = v
+			}
+		}
+		r.Value = picked.value
+		if !satisfy(picked.value, total, c) {
+			r.PID = picked.pid
+		}
+	default:
+		picked := values[0]
+		for _, v := range values[1:] {
+			if isMoreFavourable(v.value, picked.value, c.Operator) || (!satisfy(picked.value, total, c) && satisfy(v.value, total, c)) {
+				picked = v
+			}
+		}
+		r.PID, r.Value = picked.pid, picked.value
+	}
+	r.Satisfied = satisfy(r.Value, total, c)
+	return r, nil
+}
+
+// isMoreFavourable reports whether value a is closer than b to satisfy operator.
+func isMoreFavourable(a float64, b float64, operator string) bool {
+	switch operator {
+	case ">", ">=":
+		return a > b
+	case "<", "<=":
+		return a < b
+	}
+	return false
+}
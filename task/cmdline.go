@@ -0,0 +1,179 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"scp_delegator/config"
+	"strings"
+)
+
+// cmdSpecialChars are characters which cmd.exe interprets or uses to split arguments of script,
+// arguments containing them are quoted.
+const cmdSpecialChars = " \t&|<>^(),;=!\"%'`"
+
+// actionArguments returns each command and value of action arguments as a separate argument.
+func actionArguments(action *config.Action) []string {
+	args := make([]string, 0, 2*len(action.Arguments))
+	for _, arg := range action.Arguments {
+		if arg.Command != "" {
+			args = append(args, arg.Command)
+		}
+		if arg.Value != "" {
+			args = append(args, arg.Value)
+		}
+	}
+	return args
+}
+
+// rawArguments joins arguments of action by space without quoting.
+func rawArguments(action *config.Action) string {
+	return strings.Join(actionArguments(action), " ")
+}
+
+// IsCmdScript returns true if path is a script interpreted by cmd.exe.
+func IsCmdScript(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".cmd" || ext == ".bat"
+}
+
+// QuoteWindowsArg quotes argument so that it is parsed back by CommandLineToArgvW and C runtime of Windows programs.
+func QuoteWindowsArg(s string) string {
+	if s == "" {
+		return `""`
+	}
+	if !strings.ContainsAny(s, " \t\n\v\"") {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			slashes++
+		case '"':
+			// Backslashes preceding a quote are escaped, and so is the quote.
+			sb.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		sb.WriteByte(s[i])
+	}
+	// Backslashes before the closing quote are escaped.
+	sb.WriteString(strings.Repeat(`\`, slashes))
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// QuoteCmdArg quotes argument of a script run by cmd.exe. Quotes are doubled and percent signs are escaped to avoid
+// variable expansion, backslashes are kept as is since cmd.exe doesn't treat them as escapes, unlike C runtime.
+// It returns error if argument contains line break which cmd.exe can't pass to script.
+func QuoteCmdArg(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return "", errors.New(fmt.Sprintf("argument %q contains line break which can't be passed to script", s))
+	}
+	if s != "" && !strings.ContainsAny(s, cmdSpecialChars) {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			sb.WriteByte('"')
+		case '%':
+			// Expansion of %cd:~,% is empty, which breaks %name% into literal text.
+			sb.WriteString("%%cd:~,")
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String(), nil
+}
+
+// ComposeCommandLine quotes arguments by rules of cmd.exe if script is true, otherwise by rules of Windows programs,
+// and joins them by space.
+func ComposeCommandLine(args []string, script bool) (string, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if !script {
+			quoted[i] = QuoteWindowsArg(arg)
+			continue
+		}
+		q, err := QuoteCmdArg(arg)
+		if err != nil {
+			return "", err
+		}
+		quoted[i] = q
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// cmdScriptArgs returns arguments of cmd.exe which run script with arguments line composed already.
+// They are joined by space as is, since with /s cmd.exe removes the outer quotes and keeps everything between them.
+func cmdScriptArgs(script string, line string) ([]string, error) {
+	path, err := QuoteCmdArg(script)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"/d", "/e:ON", "/v:OFF", "/s", "/c", `"` + path + " " + line + `"`}, nil
+}
+
+// SplitCommandLine splits raw command line into arguments like POSIX shell does without expansion.
+// Single quotes keep text literally, backslash escapes next character except inside single quotes.
+func SplitCommandLine(s string) ([]string, error) {
+	args := make([]string, 0)
+	var sb strings.Builder
+	inArg := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				sb.WriteByte(c)
+			}
+		case c == '\\':
+			if i+1 >= len(s) {
+				return nil, errors.New("command line ends with backslash")
+			}
+			i++
+			if quote == '"' && !strings.ContainsRune("\"\\$`", rune(s[i])) {
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(s[i])
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				sb.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				inArg = false
+			}
+		default:
+			sb.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New(fmt.Sprintf("unterminated quote %c in command line", quote))
+	}
+	if inArg {
+		args = append(args, sb.String())
+	}
+	return args, nil
+}
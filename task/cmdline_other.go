@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package task
+
+import (
+	"os/exec"
+	"scp_delegator/config"
+)
+
+// setCommandLine appends arguments of action to cmd, raw command line is split like POSIX shell does.
+func setCommandLine(cmd *exec.Cmd, action *config.Action) error {
+	if !action.RawCommandLine {
+		cmd.Args = append(cmd.Args, actionArguments(action)...)
+		return nil
+	}
+
+	args, err := SplitCommandLine(rawArguments(action))
+	if err != nil {
+		return err
+	}
+	cmd.Args = append(cmd.Args, args...)
+	return nil
+}
@@ -0,0 +1,160 @@
+package task
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuoteWindowsArg(t *testing.T) {
+	cases := []struct {
+		arg  string
+		want string
+	}{
+		{"", `""`},
+		{"abc", "abc"},
+		{"a b", `"a b"`},
+		{"a\tb", "\"a\tb\""},
+		{`C:\dir\`, `C:\dir\`},
+		{`C:\Program Files\`, `"C:\Program Files\\"`},
+		{`C:\Program Files\\`, `"C:\Program Files\\\\"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`a\"b`, `"a\\\"b"`},
+		{`\\server\share dir\x`, `"\\server\share dir\x"`},
+		{"%PATH%", "%PATH%"},
+		{"a&b|c^", "a&b|c^"},
+	}
+	for _, c := range cases {
+		if got := QuoteWindowsArg(c.arg); got != c.want {
+			t.Errorf("QuoteWindowsArg(%q) = %s, want %s", c.arg, got, c.want)
+		}
+	}
+}
+
+func TestQuoteCmdArg(t *testing.T) {
+	cases := []struct {
+		arg  string
+		want string
+	}{
+		{"", `""`},
+		{"abc", "abc"},
+		{`C:\dir\`, `C:\dir\`},
+		{"a b", `"a b"`},
+		{`C:\Program Files\`, `"C:\Program Files\"`},
+		{`C:\a b\\`, `"C:\a b\\"`},
+		{`say "hi"`, `"say ""hi"""`},
+		{"%PATH%", `"%%cd:~,%PATH%%cd:~,%"`},
+		{"100%", `"100%%cd:~,%"`},
+		{"a&b", `"a&b"`},
+		{"a|b", `"a|b"`},
+		{"a^b", `"a^b"`},
+		{"a>b", `"a>b"`},
+		{"(x)", `"(x)"`},
+		{"!x!", `"!x!"`},
+	}
+	for _, c := range cases {
+		got, err := QuoteCmdArg(c.arg)
+		if err != nil {
+			t.Errorf("QuoteCmdArg(%q) returns error %s", c.arg, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("QuoteCmdArg(%q) = %s, want %s", c.arg, got, c.want)
+		}
+	}
+
+	for _, arg := range []string{"a\nb", "a\rb", "a\x00b"} {
+		if _, err := QuoteCmdArg(arg); err == nil {
+			t.Errorf("QuoteCmdArg(%q) should return error", arg)
+		}
+	}
+}
+
+func TestComposeCommandLine(t *testing.T) {
+	cases := []struct {
+		args   []string
+		script bool
+		want   string
+	}{
+		{[]string{}, false, ""},
+		{[]string{"-o", `C:\out dir\`, ""}, false, `-o "C:\out dir\\" ""`},
+		{[]string{"-o", `C:\out dir\`, ""}, true, `-o "C:\out dir\" ""`},
+		{[]string{"%TEMP%", "a&b"}, false, "%TEMP% a&b"},
+		{[]string{"%TEMP%", "a&b"}, true, `"%%cd:~,%TEMP%%cd:~,%" "a&b"`},
+		{[]string{`say "hi"`}, false, `"say \"hi\""`},
+		{[]string{`say "hi"`}, true, `"say ""hi"""`},
+	}
+	for _, c := range cases {
+		got, err := ComposeCommandLine(c.args, c.script)
+		if err != nil {
+			t.Errorf("ComposeCommandLine(%q, %v) returns error %s", c.args, c.script, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ComposeCommandLine(%q, %v) = %s, want %s", c.args, c.script, got, c.want)
+		}
+	}
+
+	if _, err := ComposeCommandLine([]string{"a\nb"}, true); err == nil {
+		t.Error("ComposeCommandLine should refuse line break in script argument")
+	}
+}
+
+func TestCmdScriptArgs(t *testing.T) {
+	cases := []struct {
+		script string
+		line   string
+		want   string
+	}{
+		{`C:\tools\run.bat`, "x", `/d /e:ON /v:OFF /s /c "C:\tools\run.bat x"`},
+		{`C:\My Scripts\run.cmd`, `"a b" x`, `/d /e:ON /v:OFF /s /c ""C:\My Scripts\run.cmd" "a b" x"`},
+		{`C:\100%\run.bat`, "", `/d /e:ON /v:OFF /s /c ""C:\100%%cd:~,%\run.bat" "`},
+	}
+	for _, c := range cases {
+		args, err := cmdScriptArgs(c.script, c.line)
+		if err != nil {
+			t.Errorf("cmdScriptArgs(%q, %q) returns error %s", c.script, c.line, err)
+			continue
+		}
+		if got := strings.Join(args, " "); got != c.want {
+			t.Errorf("cmdScriptArgs(%q, %q) = %s, want %s", c.script, c.line, got, c.want)
+		}
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{}},
+		{"  ", []string{}},
+		{"a b\t c\n", []string{"a", "b", "c"}},
+		{`"a b" c`, []string{"a b", "c"}},
+		{`'a "b"' c`, []string{`a "b"`, "c"}},
+		{`a\ b`, []string{"a b"}},
+		{`"a\"b"`, []string{`a"b`}},
+		{`"a\b"`, []string{`a\b`}},
+		{`'a\b'`, []string{`a\b`}},
+		{`"$HOME" %PATH%`, []string{"$HOME", "%PATH%"}},
+		{`a&b "x|y"`, []string{"a&b", "x|y"}},
+		{`"" ''`, []string{"", ""}},
+		{`a"b c"d`, []string{"ab cd"}},
+	}
+	for _, c := range cases {
+		got, err := SplitCommandLine(c.line)
+		if err != nil {
+			t.Errorf("SplitCommandLine(%q) returns error %s", c.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("SplitCommandLine(%q) = %q, want %q", c.line, got, c.want)
+		}
+	}
+
+	for _, line := range []string{`a\`, `"abc`, `'abc`} {
+		if _, err := SplitCommandLine(line); err == nil {
+			t.Errorf("SplitCommandLine(%q) should return error", line)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+//go:build windows
+// +build windows
+
+package task
+
+import (
+	"os"
+	"os/exec"
+	"scp_delegator/config"
+	"strings"
+	"syscall"
+)
+
+// setCommandLine composes command line of executable at cmd.Path with arguments of action.
+// Scripts are run by cmd.exe explicitly, since CreateProcess would parse their arguments by rules of cmd.exe anyway.
+func setCommandLine(cmd *exec.Cmd, action *config.Action) error {
+	script := IsCmdScript(cmd.Path)
+	if !script && !action.RawCommandLine {
+		// Arguments are quoted by exec package the same as QuoteWindowsArg.
+		cmd.Args = append(cmd.Args, actionArguments(action)...)
+		return nil
+	}
+
+	line := rawArguments(action)
+	if !action.RawCommandLine {
+		l, err := ComposeCommandLine(actionArguments(action), true)
+		if err != nil {
+			return err
+		}
+		line = l
+	}
+	if !script {
+		cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: QuoteWindowsArg(cmd.Path) + " " + line}
+		return nil
+	}
+
+	args, err := cmdScriptArgs(cmd.Path, line)
+	if err != nil {
+		return err
+	}
+	comSpec := os.Getenv("ComSpec")
+	if comSpec == "" {
+		comSpec = "cmd.exe"
+	}
+	cmd.Path = comSpec
+	cmd.Args = append([]string{comSpec}, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: QuoteWindowsArg(comSpec) + " " + strings.Join(args, " ")}
+	return nil
+}
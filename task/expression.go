@@ -0,0 +1,393 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"strings"
+	"unicode"
+)
+
+// ExpressionMetrics maps identifiers of condition expression to types of ConditionCheckerMap.
+var ExpressionMetrics = map[string]string{
+	"cpu":     "CPU",
+	"mem":     "Memory",
+	"handles": "Handles",
+	"disk":    "DiskAvailableUsage",
+}
+
+// ExpressionFunction is a boolean function callable in condition expression.
+type ExpressionFunction func(args []string) (bool, error)
+
+// ExpressionFunctions lists functions callable in condition expression, arguments are string literals.
+var ExpressionFunctions = map[string]ExpressionFunction{
+	"file_exists": expressionFileExists,
+}
+
+func expressionFileExists(args []string) (bool, error) {
+	if len(args) != 1 {
+		return false, errors.New(fmt.Sprintf("file_exists expects 1 argument, got %d", len(args)))
+	}
+	_, err := os.Stat(filepath.Clean(args[0]))
+	if err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Expression is a parsed boolean expression of condition, for example
+// "(cpu > 80 && mem > 500) || handles > 10000 && !file_exists('C:\stop')".
+// Operator && binds tighter than ||, string literals are quoted by single quote without escaping,
+// and numbers may be followed by unit like 512MB or 10%.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// exprContext carries target condition and collects comparisons which are satisfied during evaluation.
+type exprContext struct {
+	condition *config.Condition
+	hits      []string
+}
+
+type exprNode interface {
+	evaluate(ctx *exprContext) (bool, error)
+}
+
+type exprOr struct{ left, right exprNode }
+type exprAnd struct{ left, right exprNode }
+type exprNot struct{ operand exprNode }
+type exprBool struct{ value bool }
+
+type exprCall struct {
+	name string
+	fn   ExpressionFunction
+	args []string
+}
+
+// exprCompare compares a metric with constant, the metric is always on left side after parsing.
+// Each comparison keeps its own check context, so stateful checkers like CPU find their previous sample.
+type exprCompare struct {
+	metric    string
+	operator  string
+	threshold config.Threshold
+	check     *CheckContext
+}
+
+func (n *exprOr) evaluate(ctx *exprContext) (bool, error) {
+	l, err := n.left.evaluate(ctx)
+	if err != nil || l {
+		return l, err
+	}
+	return n.right.evaluate(ctx)
+}
+
+func (n *exprAnd) evaluate(ctx *exprContext) (bool, error) {
+	l, err := n.left.evaluate(ctx)
+	if err != nil || !l {
+		return l, err
+	}
+	return n.right.evaluate(ctx)
+}
+
+func (n *exprNot) evaluate(ctx *exprContext) (bool, error) {
+	v, err := n.operand.evaluate(ctx)
+	return !v, err
+}
+
+func (n *exprBool) evaluate(ctx *exprContext) (bool, error) {
+	return n.value, nil
+}
+
+func (n *exprCall) evaluate(ctx *exprContext) (bool, error) {
+	v, err := n.fn(n.args)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("%s failed, error=%s", n.name, err.Error()))
+	}
+	return v, nil
+}
+
+func (n *exprCompare) evaluate(ctx *exprContext) (bool, error) {
+	criteriaType := ExpressionMetrics[n.metric]
+	checker := ConditionCheckerMap[criteriaType]
+	if checker == nil {
+		return false, errors.New(fmt.Sprintf("invalid metric %s in expression", n.metric))
+	}
+
+	c := &config.ConditionCriteria{Type: criteriaType, Threshold: n.threshold, Operator: n.operator}
+	n.check.Condition = ctx.condition
+	result, err := checker(n.check, c)
+	if err != nil || result == nil {
+		// No result until checker has enough samples.
+		return false, err
+	}
+	satisfied := result.Satisfied
+	if satisfied {
+		hit := fmt.Sprintf("%s %s %s, value=%.2f", n.metric, n.operator, n.threshold, result.Value)
+		if result.PID > 0 {
+			hit += fmt.Sprintf(", PID=%d", result.PID)
+		}
+		ctx.hits = append(ctx.hits, hit)
+	}
+	return satisfied, nil
+}
+
+// Evaluate evaluates expression against processes monitored by condition,
+// it returns descriptions of satisfied comparisons as well.
+func (e *Expression) Evaluate(cond *config.Condition) (bool, []string, error) {
+	ctx := &exprContext{condition: cond}
+	v, err := e.root.evaluate(ctx)
+	return v, ctx.hits, err
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// ParseExpression parses boolean expression of condition.
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, errors.New(fmt.Sprintf("unexpected %s at position %d", t.text, t.pos))
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenString
+	tokenOperator
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Operators of expression, longer ones first so that they are matched before their prefix.
+var expressionOperators = []string{"&&", "||", ">=", "<=", "!=", "==", "<>", ">", "<", "!", "(", ")", ","}
+
+func tokenizeExpression(source string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	for i := 0; i < len(source); {
+		ch := rune(source[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '\'':
+			end := strings.IndexByte(source[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New(fmt.Sprintf("unterminated string at position %d", i))
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: source[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case unicode.IsDigit(ch) || ch == '.':
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			// Unit of number
+			for i < len(source) && (unicode.IsLetter(rune(source[i])) || source[i] == '%') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: source[start:i], pos: start})
+		case unicode.IsLetter(ch) || ch == '_':
+			start := i
+			for i < len(source) && (unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i])) || source[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: source[start:i], pos: start})
+		default:
+			matched := false
+			for _, op := range expressionOperators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, exprToken{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, errors.New(fmt.Sprintf("unexpected character %c at position %d", ch, i))
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEnd, text: "end of expression", pos: len(source)}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	next   int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) take() exprToken {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOperator && t.text == op {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return errors.New(fmt.Sprintf("expect %s but got %s at position %d", op, t.text, t.pos))
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNot{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.accept("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	}
+
+	t := p.peek()
+	if t.kind == tokenIdent {
+		switch t.text {
+		case "true", "false":
+			p.take()
+			return &exprBool{value: t.text == "true"}, nil
+		}
+		if fn, ok := ExpressionFunctions[t.text]; ok {
+			p.take()
+			return p.parseCall(t.text, fn)
+		}
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCall(name string, fn ExpressionFunction) (exprNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	n := &exprCall{name: name, fn: fn, args: make([]string, 0)}
+	if p.accept(")") {
+		return n, nil
+	}
+	for {
+		t := p.take()
+		if t.kind != tokenString {
+			return nil, errors.New(fmt.Sprintf("expect string argument of %s but got %s at position %d", name, t.text, t.pos))
+		}
+		n.args = append(n.args, t.text)
+		if p.accept(")") {
+			return n, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// flippedOperators swaps sides of comparison, so that "80 < cpu" equals to "cpu > 80".
+var flippedOperators = map[string]string{
+	">": "<", ">=": "<=", "<": ">", "<=": ">=", "==": "==", "<>": "<>", "!=": "!=",
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left := p.take()
+	if left.kind != tokenIdent && left.kind != tokenNumber {
+		return nil, errors.New(fmt.Sprintf("unexpected %s at position %d", left.text, left.pos))
+	}
+	op := p.take()
+	right := p.take()
+	if op.kind != tokenOperator || !IsValidOperator(op.text) {
+		return nil, errors.New(fmt.Sprintf("expect comparison operator but got %s at position %d", op.text, op.pos))
+	}
+
+	metric, number, operator := left, right, op.text
+	if left.kind == tokenNumber {
+		metric, number, operator = right, left, flippedOperators[op.text]
+	}
+	if metric.kind != tokenIdent {
+		return nil, errors.New(fmt.Sprintf("expect metric but got %s at position %d", metric.text, metric.pos))
+	}
+	if _, ok := ExpressionMetrics[metric.text]; !ok {
+		return nil, errors.New(fmt.Sprintf("unknown metric %s at position %d", metric.text, metric.pos))
+	}
+	if number.kind != tokenNumber {
+		return nil, errors.New(fmt.Sprintf("expect number but got %s at position %d", number.text, number.pos))
+	}
+	threshold, err := config.ParseThreshold(number.text)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s at position %d", err.Error(), number.pos))
+	}
+	if !IsValidThresholdUnit(ExpressionMetrics[metric.text], threshold.Unit) {
+		return nil, errors.New(fmt.Sprintf("unit %s is not supported by %s at position %d", threshold.Unit, metric.text, number.pos))
+	}
+	return &exprCompare{metric: metric.text, operator: operator, threshold: threshold, check: &CheckContext{}}, nil
+}
@@ -0,0 +1,157 @@
+package task
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"scp_delegator/config"
+	"strings"
+	"testing"
+)
+
+// useSampledMetric registers metric "sampled" whose checker is satisfied only when it has a previous sample,
+// like CPU usage which needs two samples.
+func useSampledMetric(t *testing.T) {
+	ExpressionMetrics["sampled"] = "Sampled"
+	ConditionCheckerMap["Sampled"] = func(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+		st, _ := ctx.State(c, func() (interface{}, error) { return new(int), nil })
+		samples := st.(*int)
+		*samples++
+		if *samples == 1 {
+			return nil, nil
+		}
+		return valueResult(float64(*samples), c), nil
+	}
+	t.Cleanup(func() {
+		delete(ExpressionMetrics, "sampled")
+		delete(ConditionCheckerMap, "Sampled")
+	})
+}
+
+func TestParseExpression(t *testing.T) {
+	cases := []struct {
+		source string
+		want   *exprCompare
+	}{
+		{"cpu > 80", &exprCompare{metric: "cpu", operator: ">", threshold: config.Threshold{Value: 80}}},
+		{"80 < cpu", &exprCompare{metric: "cpu", operator: ">", threshold: config.Threshold{Value: 80}}},
+		{"80 >= cpu", &exprCompare{metric: "cpu", operator: "<=", threshold: config.Threshold{Value: 80}}},
+		{"cpu>10%", &exprCompare{metric: "cpu", operator: ">", threshold: config.Threshold{Value: 10, Unit: "%"}}},
+		{"mem > 512MB", &exprCompare{metric: "mem", operator: ">", threshold: config.Threshold{Value: 512, Unit: "MB"}}},
+		{"1.5GB <= disk", &exprCompare{metric: "disk", operator: ">=", threshold: config.Threshold{Value: 1.5, Unit: "GB"}}},
+		{"handles != 100", &exprCompare{metric: "handles", operator: "!=", threshold: config.Threshold{Value: 100}}},
+	}
+	for _, c := range cases {
+		e, err := ParseExpression(c.source)
+		if err != nil {
+			t.Errorf("ParseExpression(%q) returns error %s", c.source, err)
+			continue
+		}
+		got, ok := e.root.(*exprCompare)
+		if !ok || got.metric != c.want.metric || got.operator != c.want.operator || got.threshold != c.want.threshold {
+			t.Errorf("ParseExpression(%q) = %+v, want %+v", c.source, e.root, c.want)
+		}
+	}
+}
+
+func TestParseExpressionError(t *testing.T) {
+	cases := []struct {
+		source string
+		want   string
+	}{
+		{"", "unexpected end of expression at position 0"},
+		{"cpu >", "expect number but got end of expression at position 5"},
+		{"cpu > 80 &&", "unexpected end of expression at position 11"},
+		{"(cpu > 80", "expect ) but got end of expression at position 9"},
+		{"cpu > 80)", "unexpected ) at position 8"},
+		{"gpu > 80", "unknown metric gpu at position 0"},
+		{"80 < 90", "expect metric but got 90 at position 5"},
+		{"cpu = 80", "unexpected character = at position 4"},
+		{"cpu && 80", "expect comparison operator but got && at position 4"},
+		{"handles > 10MB", "unit MB is not supported by handles at position 10"},
+		{"cpu > 10XB", "unknown unit XB of threshold 10XB at position 6"},
+		{"file_exists(1)", "expect string argument of file_exists but got 1 at position 12"},
+		{"file_exists('a' 'b')", "expect , but got b at position 16"},
+		{"file_exists('C:\\stop)", "unterminated string at position 12"},
+	}
+	for _, c := range cases {
+		_, err := ParseExpression(c.source)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("ParseExpression(%q) returns error %v, want %s", c.source, err, c.want)
+		}
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	useTestLog(t)
+	dir := t.TempDir()
+	exists := filepath.Join(dir, "exists")
+	if err := ioutil.WriteFile(exists, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	cases := []struct {
+		source string
+		want   bool
+	}{
+		// && binds tighter than ||.
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"false && true || true", true},
+		{"false && (true || true)", false},
+		{"!false && !!true", true},
+		{"!(true || false)", false},
+		{"file_exists('" + exists + "')", true},
+		{"file_exists('" + missing + "')", false},
+		{"!file_exists('" + missing + "')", true},
+		{"!file_exists('" + exists + "') || false", false},
+	}
+	for _, c := range cases {
+		e, err := ParseExpression(c.source)
+		if err != nil {
+			t.Errorf("ParseExpression(%q) returns error %s", c.source, err)
+			continue
+		}
+		got, hits, err := e.Evaluate(&config.Condition{ID: 1})
+		if err != nil || got != c.want {
+			t.Errorf("%s = %v, error %v, want %v", c.source, got, err, c.want)
+		}
+		if len(hits) != 0 {
+			t.Errorf("%s hits %v without comparison", c.source, hits)
+		}
+	}
+
+	e, err := ParseExpression("file_exists('a', 'b')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := e.Evaluate(&config.Condition{ID: 1}); err == nil || !strings.Contains(err.Error(), "file_exists failed") {
+		t.Errorf("evaluating file_exists with 2 arguments returns error %v", err)
+	}
+}
+
+func TestEvaluateExpressionKeepsSamples(t *testing.T) {
+	useTestLog(t)
+	useSampledMetric(t)
+	e, err := ParseExpression("sampled > 1 && 2 <= sampled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond := &config.Condition{ID: 1}
+
+	// The first evaluation only takes samples.
+	if got, _, err := e.Evaluate(cond); err != nil || got {
+		t.Errorf("first evaluation = %v, error %v, want false without previous sample", got, err)
+	}
+	// Comparisons keep their own samples, the right one was skipped when left one wasn't satisfied.
+	if got, _, err := e.Evaluate(cond); err != nil || got {
+		t.Errorf("second evaluation = %v, error %v, want false before right side has previous sample", got, err)
+	}
+	got, hits, err := e.Evaluate(cond)
+	if err != nil || !got {
+		t.Errorf("third evaluation = %v, error %v, want true with previous samples", got, err)
+	}
+	if len(hits) != 2 || hits[0] != "sampled > 1, value=3.00" || hits[1] != "sampled >= 2, value=2.00" {
+		t.Errorf("hits of expression are %q", hits)
+	}
+}
@@ -0,0 +1,154 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"time"
+)
+
+// PathCriteria lists criteria types which read Paths of criteria.
+var PathCriteria = map[string]bool{
+	"LogPattern":    true,
+	"FileExists":    true,
+	"FileAbsent":    true,
+	"FileSize":      true,
+	"DirectorySize": true,
+	"FileModified":  true,
+	"FileCount":     true,
+}
+
+// globPaths expands glob patterns of paths into existing file names without duplication.
+func globPaths(paths []string) ([]string, error) {
+	seen := make(map[string]bool)
+	results := make([]string, 0)
+	for _, p := range paths {
+		names, err := filepath.Glob(p)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid path %s, error=%s", p, err.Error()))
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				results = append(results, name)
+			}
+		}
+	}
+	return results, nil
+}
+
+// statFiles returns information of regular files matching paths of criteria.
+func statFiles(c *config.ConditionCriteria) ([]os.FileInfo, error) {
+	names, err := globPaths(c.Paths)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil || info.IsDir() {
+			// File may be removed after globbing.
+			continue
+		}
+		results = append(results, info)
+	}
+	return results, nil
+}
+
+func valueResult(value float64, c *config.ConditionCriteria) *CheckResult {
+	return capacityResult(value, 0, c)
+}
+
+func capacityResult(value float64, total float64, c *config.ConditionCriteria) *CheckResult {
+	return &CheckResult{Value: value, Total: total, Satisfied: satisfy(value, total, c)}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ConditionCheckerFileExists is 1 if any path exists, otherwise 0.
+func ConditionCheckerFileExists(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	names, err := globPaths(c.Paths)
+	if err != nil {
+		return nil, err
+	}
+	return valueResult(boolValue(len(names) > 0), c), nil
+}
+
+// ConditionCheckerFileAbsent is 1 if none of paths exists, otherwise 0.
+func ConditionCheckerFileAbsent(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	names, err := globPaths(c.Paths)
+	if err != nil {
+		return nil, err
+	}
+	return valueResult(boolValue(len(names) == 0), c), nil
+}
+
+// ConditionCheckerFileSize is size in bytes of the largest file matching paths.
+func ConditionCheckerFileSize(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	files, err := statFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	largest := int64(0)
+	for _, f := range files {
+		if f.Size() > largest {
+			largest = f.Size()
+		}
+	}
+	return valueResult(float64(largest), c), nil
+}
+
+// ConditionCheckerDirectorySize is total size in bytes of files under directories matching paths.
+func ConditionCheckerDirectorySize(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	names, err := globPaths(c.Paths)
+	if err != nil {
+		return nil, err
+	}
+	total := int64(0)
+	for _, name := range names {
+		_ = filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+			// Skip entries which are removed or not accessible during walking.
+			if err == nil && !info.IsDir() {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return valueResult(float64(total), c), nil
+}
+
+// ConditionCheckerFileModified is seconds since the latest modification of files matching paths,
+// it is infinity if no file matches.
+func ConditionCheckerFileModified(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	files, err := statFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return valueResult(math.Inf(1), c), nil
+	}
+	latest := files[0].ModTime()
+	for _, f := range files[1:] {
+		if f.ModTime().After(latest) {
+			latest = f.ModTime()
+		}
+	}
+	return valueResult(time.Since(latest).Seconds(), c), nil
+}
+
+// ConditionCheckerFileCount is count of files matching paths.
+func ConditionCheckerFileCount(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	files, err := statFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	return valueResult(float64(len(files)), c), nil
+}
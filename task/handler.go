@@ -4,8 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
-	"os/exec"
 	"path/filepath"
 	"scp_delegator/config"
 	"scp_delegator/constant"
@@ -26,8 +24,10 @@ const (
 )
 
 const (
-	DefaultValueTimeoutS    = 600
-	DefaultValueRepeatCount = 1
+	DefaultValueTimeoutS       = 600
+	DefaultValueRepeatCount    = 1
+	DefaultValueRetryDelayS    = 4
+	DefaultValueMaxRetryDelayS = 120
 )
 
 type SingleTaskHandler struct {
@@ -133,6 +133,9 @@ func (h *SingleTaskHandler) execCommand() {
 	logger.Wrapper.LogTrace("Task handler %d end to execute command", h.material.TaskID)
 }
 
+// execCommandOnce runs pre-action, action and post-action in order. Failure of pre-action is only logged since it
+// usually cleans up state which may not exist, e.g. cancels a stale recording. Post-action still runs if action
+// failed, and error of action is returned in that case.
 func (h *SingleTaskHandler) execCommandOnce() error {
 	if h.material.ActionMaterial.Action.PreAction != 0 {
 		act := config.GetTemplateAction(h.config, h.material.ActionMaterial.Action.PreAction)
@@ -145,11 +148,13 @@ func (h *SingleTaskHandler) execCommandOnce() error {
 			return errors.New(fmt.Sprintf("can't get pre-action property from template ID %d", act.Property))
 		}
 		// Get pre-action & action property
-		exeCommand(&h.ctx, act)
+		if err := h.runAction(act, actProperty); err != nil {
+			logger.Wrapper.LogInfo("Pre-action of task %d failed, %s", h.material.TaskID, err.Error())
+		}
 	}
 
-	exeCommand(&h.ctx, h.material.ActionMaterial.Action)
-	if h.material.ActionMaterial.ActProperty.PeriodS != 0 {
+	actErr := h.runAction(h.material.ActionMaterial.Action, h.material.ActionMaterial.ActProperty)
+	if actErr == nil && h.material.ActionMaterial.ActProperty.PeriodS != 0 {
 		time.Sleep(time.Second * time.Duration(h.material.ActionMaterial.ActProperty.PeriodS))
 	}
 
@@ -164,27 +169,54 @@ func (h *SingleTaskHandler) execCommandOnce() error {
 			return errors.New(fmt.Sprintf("can't get post-action property from template ID %d", act.Property))
 		}
 		// Get pre-action & action property
-		exeCommand(&h.ctx, act)
+		if err := h.runAction(act, actProperty); err != nil && actErr == nil {
+			return errors.New(fmt.Sprintf("post-action %s", err.Error()))
+		}
 	}
-	return nil
+	return actErr
 }
 
-func composeInnerArguments(action *config.Action) string{
-	var sb strings.Builder
-	if action.Arguments!=nil && len(action.Arguments) > 0 {
-		for _, arg := range action.Arguments {
-			if arg.Command != "" {
-				sb.WriteString(arg.Command)
-				sb.WriteString(" ")
-			}
-			if arg.Value != "" {
-				sb.WriteString(arg.Value)
-				sb.WriteString(" ")
-			}
+// runAction executes action and retries it with backoff by retry property until it succeeds.
+func (h *SingleTaskHandler) runAction(action *config.Action, property *config.ActionProperty) error {
+	delayS := property.Retry.DelayS
+	if delayS == 0 {
+		delayS = DefaultValueRetryDelayS
+	}
+	maxDelayS := property.Retry.MaxDelayS
+	if maxDelayS == 0 {
+		maxDelayS = DefaultValueMaxRetryDelayS
+	}
+
+	for attempt := uint32(0); ; attempt++ {
+		r := exeCommand(&h.ctx, h.material.TaskID, action)
+		if r.Succeeded {
+			return nil
+		}
+		err := errors.New(fmt.Sprintf("action %d failed, %s", action.ID, r.Failure))
+		if attempt >= property.Retry.Count {
+			return err
+		}
+
+		logger.Wrapper.LogInfo("Retry action %d in %d seconds, retry %d of %d", action.ID, delayS, attempt+1, property.Retry.Count)
+		select {
+		case <-h.ctx.Done():
+			return err
+		case <-time.After(time.Duration(delayS) * time.Second):
+		}
+		if delayS *= 2; delayS > maxDelayS {
+			delayS = maxDelayS
 		}
 	}
+}
 
-	return strings.Trim(sb.String(), " ")
+// composeInnerArguments renders arguments into command line of embedded tool, which is passed to executor as one
+// argument. Each argument is quoted by rules of cmd.exe for scripts or Windows programs otherwise,
+// arguments are joined as is in raw command line mode.
+func composeInnerArguments(action *config.Action) (string, error) {
+	if action.RawCommandLine {
+		return strings.Trim(rawArguments(action), " "), nil
+	}
+	return ComposeCommandLine(actionArguments(action), IsCmdScript(action.Executable))
 }
 
 func composeArgument(action *config.Action) string {
@@ -201,41 +233,53 @@ func composeBinaryPath() string {
 	return strings.Trim(path, " ")
 }
 
-func exeCommand(ctx *context.Context, action *config.Action) {
-	bin := composeBinaryPath()
-	arg := composeArgument(action)
-	innerArg := composeInnerArguments(action)
-
-	cmd := exec.CommandContext(*ctx, bin, arg, innerArg)
-	logger.Wrapper.LogTrace("Execute command %s\n", cmd.String())
-
-	// Blocking here util process finished or timeout triggered by context
-	// If output path is not empty then output to specific path.
-	if action.Output != "" {
-		result, err := cmd.CombinedOutput()
-		outputFile(action.Output, result)
-		if err != nil {
-			logger.Wrapper.LogError("Execute command error %s", err.Error())
-		}
-	} else {
-		err := cmd.Run()
+// exeCommand runs action until it finishes or context is done, and records result of the execution.
+func exeCommand(ctx *context.Context, taskID uint32, action *config.Action) *ActionResult {
+	r := newActionResult(taskID, action)
+	if native, ok := NativeActionMap[action.Kind]; ok {
+		logger.Wrapper.LogTrace("Execute native action %s, ID=%d\n", action.Kind, action.ID)
+		err := native(*ctx, action)
 		if err != nil {
-			logger.Wrapper.LogError("Execute command error %s", err.Error())
+			logger.Wrapper.LogError("Execute native action error %s", err.Error())
+		} else {
+			r.ExitCode = 0
 		}
+		r.finish(err, action, nil)
+		return r
 	}
-}
 
-func outputFile(fileName string, data []byte) {
-	p := filepath.Join(config.GetOutputDir(), fileName)
-	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	matcher, err := newOutputMatcher(action)
+	if err != nil {
+		logger.Wrapper.LogError("Can't check output of action %d, error %s", action.ID, err.Error())
+		r.finish(err, action, nil)
+		return r
+	}
+	cmd, err := buildCommand(*ctx, action)
 	if err != nil {
-		logger.Wrapper.LogError("Get error during opening file %s, error %s", fileName, err.Error())
-		return
+		logger.Wrapper.LogError("Can't build command of action %d, error %s", action.ID, err.Error())
+		r.finish(err, action, nil)
+		return r
+	}
+	r.Command = cmd.String()
+	logger.Wrapper.LogTrace("Execute command %s\n", cmd.String())
+
+	// Output is streamed into files while command is running, so it is kept even if delegator is killed.
+	output, err := attachOutput(cmd, action, matcher)
+	if err != nil {
+		logger.Wrapper.LogError("Can't open output of action %d, error %s", action.ID, err.Error())
+		r.finish(err, action, nil)
+		return r
 	}
-	defer f.Close()
 
-	_,err = f.Write(data)
-	if err!=nil {
-		logger.Wrapper.LogError("Get error during opening file %s, error %s", fileName, err.Error())
+	// Blocking here util process finished or timeout triggered by context
+	err = cmd.Run()
+	output.close(r)
+	if cmd.ProcessState != nil {
+		r.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		logger.Wrapper.LogError("Execute command error %s", err.Error())
 	}
+	r.finish(err, action, matcher)
+	return r
 }
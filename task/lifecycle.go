@@ -0,0 +1,227 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"scp_delegator/config"
+	"scp_delegator/system"
+	"time"
+)
+
+// lifecycleCriteria lists criteria types which need process history of inspector.
+var lifecycleCriteria = map[string]bool{
+	"ProcessStarted":       true,
+	"ProcessExited":        true,
+	"ProcessRestarted":     true,
+	"ProcessAbsent":        true,
+	"ProcessNotResponding": true,
+}
+
+// ProcessEvent is a start or exit of monitored process observed between polls.
+type ProcessEvent struct {
+	PID     int32
+	At      time.Time
+	Started bool
+}
+
+// ProcessHistory tracks monitored processes across polls of inspector.
+// The first poll is baseline, processes already running at that time don't produce start events.
+type ProcessHistory struct {
+	filter    *system.ProcessFilter
+	retention time.Duration
+	polled    bool
+
+	alive  map[int32]time.Time
+	events []ProcessEvent
+	// started counts start events since the first poll, they are not retained for that long.
+	started           int
+	lastStartedPID    int32
+	absentSince       time.Time
+	unresponsiveSince map[int32]time.Time
+}
+
+// NewProcessHistory creates history of processes monitored by condition,
+// events older than retention are dropped and zero retention keeps all events.
+func NewProcessHistory(cond *config.Condition, retention time.Duration) (*ProcessHistory, error) {
+	f, err := NewProcessFilter(cond)
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessHistory{
+		filter:            f,
+		retention:         retention,
+		alive:             make(map[int32]time.Time),
+		events:            make([]ProcessEvent, 0),
+		unresponsiveSince: make(map[int32]time.Time),
+	}, nil
+}
+
+// Poll compares running processes with previous poll and records start and exit events.
+func (h *ProcessHistory) Poll(now time.Time) error {
+	ps, err := system.FindProcesses(h.filter)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[int32]bool, len(ps))
+	for _, p := range ps {
+		current[p.PID] = true
+		if _, ok := h.alive[p.PID]; !ok {
+			h.alive[p.PID] = now
+			if h.polled {
+				h.events = append(h.events, ProcessEvent{PID: p.PID, At: now, Started: true})
+				h.started++
+				h.lastStartedPID = p.PID
+			}
+		}
+	}
+	for pid := range h.alive {
+		if !current[pid] {
+			delete(h.alive, pid)
+			delete(h.unresponsiveSince, pid)
+			h.events = append(h.events, ProcessEvent{PID: pid, At: now})
+		}
+	}
+	h.polled = true
+
+	if len(h.alive) > 0 {
+		h.absentSince = time.Time{}
+	} else if h.absentSince.IsZero() {
+		h.absentSince = now
+	}
+
+	if h.retention > 0 {
+		n := 0
+		for n < len(h.events) && now.Sub(h.events[n].At) > h.retention {
+			n++
+		}
+		h.events = h.events[n:]
+	}
+	return nil
+}
+
+// eventsSince returns start or exit events recorded after given time.
+func (h *ProcessHistory) eventsSince(since time.Time, started bool) []ProcessEvent {
+	results := make([]ProcessEvent, 0)
+	for _, e := range h.events {
+		if e.Started == started && e.At.After(since) {
+			results = append(results, e)
+		}
+	}
+	return results
+}
+
+// lifecycleRetention returns how long events should be kept for lifecycle criteria.
+func lifecycleRetention(criteria []*config.ConditionCriteria) time.Duration {
+	retention := time.Duration(0)
+	for _, c := range criteria {
+		if !lifecycleCriteria[c.Type] {
+			continue
+		}
+		d := time.Duration(c.WindowS) * time.Second
+		if interval := criterionInterval(c); interval > d {
+			d = interval
+		}
+		if d > retention {
+			retention = d
+		}
+	}
+	return retention
+}
+
+func historyOf(ctx *CheckContext, c *config.ConditionCriteria) (*ProcessHistory, error) {
+	if ctx.History == nil {
+		return nil, errors.New(fmt.Sprintf("no process history for criteria, type=%s, ID=%d", c.Type, c.ID))
+	}
+	return ctx.History, nil
+}
+
+func eventsResult(events []ProcessEvent, c *config.ConditionCriteria) *CheckResult {
+	r := &CheckResult{Value: float64(len(events)), Processes: len(events)}
+	if len(events) > 0 {
+		r.PID = events[len(events)-1].PID
+	}
+	r.Satisfied = satisfy(r.Value, 0, c)
+	return r
+}
+
+// ConditionCheckerProcessStarted counts processes started within latest interval of criterion.
+func ConditionCheckerProcessStarted(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	h, err := historyOf(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return eventsResult(h.eventsSince(time.Now().Add(-criterionInterval(c)), true), c), nil
+}
+
+// ConditionCheckerProcessExited counts processes exited within latest interval of criterion.
+func ConditionCheckerProcessExited(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	h, err := historyOf(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return eventsResult(h.eventsSince(time.Now().Add(-criterionInterval(c)), false), c), nil
+}
+
+// ConditionCheckerProcessRestarted counts processes started within window of criterion,
+// or since inspector started if window is not given.
+func ConditionCheckerProcessRestarted(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	h, err := historyOf(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.WindowS == 0 {
+		// Events are retained for windows of criteria only, so restarts since inspector started are counted.
+		r := &CheckResult{Value: float64(h.started), Processes: h.started, PID: h.lastStartedPID}
+		r.Satisfied = satisfy(r.Value, 0, c)
+		return r, nil
+	}
+	since := time.Now().Add(-time.Duration(c.WindowS) * time.Second)
+	return eventsResult(h.eventsSince(since, true), c), nil
+}
+
+// ConditionCheckerProcessAbsent measures seconds since no monitored process is running.
+func ConditionCheckerProcessAbsent(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	h, err := historyOf(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	r := &CheckResult{Processes: len(h.alive)}
+	if !h.absentSince.IsZero() {
+		r.Value = time.Since(h.absentSince).Seconds()
+	}
+	r.Satisfied = satisfy(r.Value, 0, c)
+	return r, nil
+}
+
+// ConditionCheckerProcessNotResponding measures the longest seconds which a monitored process keeps not responding.
+func ConditionCheckerProcessNotResponding(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	h, err := historyOf(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	r := &CheckResult{Processes: len(h.alive)}
+	for pid := range h.alive {
+		responding, err := system.IsProcessResponding(pid)
+		if err != nil {
+			// Process may exit after latest poll.
+			continue
+		}
+		if responding {
+			delete(h.unresponsiveSince, pid)
+			continue
+		}
+		since, ok := h.unresponsiveSince[pid]
+		if !ok {
+			since = now
+			h.unresponsiveSince[pid] = now
+		}
+		if seconds := now.Sub(since).Seconds(); r.PID == 0 || seconds > r.Value {
+			r.PID, r.Value = pid, seconds
+		}
+	}
+	r.Satisfied = satisfy(r.Value, 0, c)
+	return r, nil
+}
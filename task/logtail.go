@@ -0,0 +1,206 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"scp_delegator/config"
+	"time"
+)
+
+const (
+	// Maximum bytes read from a file in one poll, the rest is read by following polls.
+	maxTailReadBytes = 4 << 20
+	// Line longer than this is matched by its beginning only.
+	maxTailLineBytes = 64 << 10
+)
+
+type tailedFile struct {
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// logTail follows log files and records times of lines matching pattern.
+// Files existing at the first poll are followed from their end, files appear later are read from beginning.
+type logTail struct {
+	paths   []string
+	pattern *regexp.Regexp
+	files   map[string]*tailedFile
+	matches []time.Time
+	polled  bool
+}
+
+func newLogTail(c *config.ConditionCriteria) (*logTail, error) {
+	if len(c.Paths) == 0 {
+		return nil, errors.New(fmt.Sprintf("no log path given, criteria ID=%d", c.ID))
+	}
+	re, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid log pattern %s, criteria ID=%d, error=%s", c.Pattern, c.ID, err.Error()))
+	}
+	return &logTail{
+		paths:   c.Paths,
+		pattern: re,
+		files:   make(map[string]*tailedFile),
+		matches: make([]time.Time, 0),
+	}, nil
+}
+
+// poll reads lines appended since previous poll of every file which matches paths.
+// Files are identified by os.SameFile, so a rotated file which still matches paths under another name
+// is followed from its previous offset instead of read again.
+func (t *logTail) poll(now time.Time) error {
+	names, err := globPaths(t.paths)
+	if err != nil {
+		return err
+	}
+	infos := make(map[string]os.FileInfo, len(names))
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if !info.IsDir() {
+			infos[name] = info
+		}
+	}
+
+	previous := t.files
+	t.files = make(map[string]*tailedFile, len(infos))
+	// Files keeping their names are claimed first, then renamed ones are looked up by identity.
+	for name, info := range infos {
+		if f := previous[name]; f != nil && os.SameFile(f.info, info) {
+			t.files[name] = f
+			delete(previous, name)
+		}
+	}
+	for name, info := range infos {
+		if t.files[name] != nil {
+			continue
+		}
+		var f *tailedFile
+		for old, p := range previous {
+			if os.SameFile(p.info, info) {
+				f = p
+				delete(previous, old)
+				break
+			}
+		}
+		if f == nil {
+			// Files removed or rotated away are forgotten, a new file is read from beginning.
+			f = &tailedFile{}
+			if !t.polled {
+				f.offset = info.Size()
+			}
+		}
+		t.files[name] = f
+	}
+
+	for _, name := range names {
+		if f := t.files[name]; f != nil {
+			if err := t.pollFile(name, infos[name], f, now); err != nil {
+				return err
+			}
+		}
+	}
+	t.polled = true
+	return nil
+}
+
+func (t *logTail) pollFile(name string, info os.FileInfo, f *tailedFile, now time.Time) error {
+	if info.Size() < f.offset {
+		// Truncated.
+		f.offset, f.partial = 0, nil
+	}
+	f.info = info
+	if info.Size() == f.offset {
+		return nil
+	}
+
+	r, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if _, err := r.Seek(f.offset, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, minInt64(info.Size()-f.offset, maxTailReadBytes))
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	f.offset += int64(n)
+
+	data := append(f.partial, buf[:n]...)
+	for {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			break
+		}
+		t.match(data[:end], now)
+		data = data[end+1:]
+	}
+	if len(data) > maxTailLineBytes {
+		t.match(data, now)
+		data = nil
+	}
+	f.partial = append([]byte(nil), data...)
+	return nil
+}
+
+func (t *logTail) match(line []byte, now time.Time) {
+	line = bytes.TrimRight(line, "\r")
+	if t.pattern.Match(line) {
+		t.matches = append(t.matches, now)
+	}
+}
+
+// countSince drops matches before given time and returns count of the rest.
+func (t *logTail) countSince(since time.Time) int {
+	n := 0
+	for n < len(t.matches) && !t.matches[n].After(since) {
+		n++
+	}
+	t.matches = t.matches[n:]
+	return len(t.matches)
+}
+
+func minInt64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ConditionCheckerLogPattern counts lines matching pattern within window of criterion,
+// or within latest interval if window is not given.
+func ConditionCheckerLogPattern(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	st, err := ctx.State(c, func() (interface{}, error) {
+		return newLogTail(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t := st.(*logTail)
+
+	now := time.Now()
+	if err := t.poll(now); err != nil {
+		return nil, err
+	}
+	window := criterionInterval(c)
+	if c.WindowS > 0 {
+		window = time.Duration(c.WindowS) * time.Second
+	}
+	r := &CheckResult{Value: float64(t.countSince(now.Add(-window)))}
+	r.Satisfied = satisfy(r.Value, 0, c)
+	return r, nil
+}
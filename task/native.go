@@ -0,0 +1,469 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"scp_delegator/config"
+	"scp_delegator/logger"
+	"scp_delegator/metric"
+	"scp_delegator/system"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Native action kinds, which run in process without external tools.
+const (
+	ActionKindCopyFiles        = "copy_files"
+	ActionKindProcessSnapshot  = "process_snapshot"
+	ActionKindSystemInfo       = "system_info"
+	ActionKindDirectoryListing = "directory_listing"
+	ActionKindCollectKeys      = "collect_keys"
+)
+
+// NativeAction runs action in process and writes results into output directory.
+type NativeAction func(ctx context.Context, action *config.Action) error
+
+// NativeActionMap is registry of native action kinds.
+var NativeActionMap = map[string]NativeAction{
+	ActionKindCopyFiles:        nativeCopyFiles,
+	ActionKindProcessSnapshot:  nativeProcessSnapshot,
+	ActionKindSystemInfo:       nativeSystemInfo,
+	ActionKindDirectoryListing: nativeDirectoryListing,
+	ActionKindCollectKeys:      nativeCollectKeys,
+}
+
+// PathActions lists native action kinds which read Paths of action.
+var PathActions = map[string]bool{
+	ActionKindCopyFiles:        true,
+	ActionKindDirectoryListing: true,
+	ActionKindCollectKeys:      true,
+}
+
+// nativeOutputNames are file or directory names in output directory used if action doesn't give Output.
+var nativeOutputNames = map[string]string{
+	ActionKindCopyFiles:        "files",
+	ActionKindProcessSnapshot:  "processes.txt",
+	ActionKindSystemInfo:       "system_info.txt",
+	ActionKindDirectoryListing: "directory_listing.txt",
+	ActionKindCollectKeys:      "keys.txt",
+}
+
+var windowsEnvPattern = regexp.MustCompile(`%[A-Za-z_][A-Za-z0-9_()]*%`)
+
+// expandEnvPaths replaces %NAME% in paths with environment variables, e.g. C:\Users\%USERNAME%\.azcopy,
+// unknown variables are kept.
+func expandEnvPaths(paths []string) []string {
+	results := make([]string, len(paths))
+	for i, p := range paths {
+		results[i] = windowsEnvPattern.ReplaceAllStringFunc(p, func(s string) string {
+			if v, ok := os.LookupEnv(s[1 : len(s)-1]); ok {
+				return v
+			}
+			return s
+		})
+	}
+	return results
+}
+
+// IsValidNativeOutput returns true if name is empty or a plain file name, output of native actions is always
+// directly under output directory.
+func IsValidNativeOutput(name string) bool {
+	return name == "" || (name != "." && name != ".." && !strings.ContainsAny(name, `/\:`))
+}
+
+func nativeOutputPath(action *config.Action) (string, error) {
+	name := action.Output
+	if name == "" {
+		name = nativeOutputNames[action.Kind]
+	}
+	return outputPathUnder(config.GetOutputDir(), name)
+}
+
+// outputPathUnder joins name to dir and rejects any path escaping dir or being dir itself.
+func outputPathUnder(dir string, name string) (string, error) {
+	p := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New(fmt.Sprintf("output %s is outside output directory", name))
+	}
+	return p, nil
+}
+
+// appendOutput appends a section headed by current time to output file of action, the same as output of commands
+// is appended, so repeated actions keep all results.
+func appendOutput(action *config.Action, write func(w io.Writer) error) error {
+	p, err := nativeOutputPath(action)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, "==== %s ====\n", time.Now().Format(time.RFC3339))
+	err = write(w)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func joinErrors(action *config.Action, errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(fmt.Sprintf("%s action %d failed with %d errors: %s", action.Kind, action.ID, len(errs), strings.Join(errs, "; ")))
+}
+
+// uniqueName appends sequence number to name until it isn't used, extension of file is kept.
+func uniqueName(name string, used map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	result := name
+	for i := 1; used[result]; i++ {
+		result = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+	used[result] = true
+	return result
+}
+
+func copyFile(src string, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// Log files may grow during copying, only the size at start is copied.
+	_, err = io.Copy(out, io.LimitReader(in, info.Size()))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// isUnderDir reports whether path is dir itself or inside it.
+func isUnderDir(path string, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyTree copies file or directory src to dst, files which can't be copied are recorded and skipped.
+// Anything under excluded directories is skipped, so a source containing dst isn't copied into itself.
+func copyTree(ctx context.Context, src string, dst string, excluded []string) []string {
+	errs := make([]string, 0)
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			return nil
+		}
+		for _, dir := range excluded {
+			if isUnderDir(path, dir) {
+				logger.Wrapper.LogInfo("Skip copying %s, it is under %s", path, dir)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			if err := os.MkdirAll(target, 0744); err != nil {
+				errs = append(errs, err.Error())
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0744); err != nil {
+			errs = append(errs, err.Error())
+			return nil
+		}
+		if err := copyFile(path, target, info); err != nil {
+			errs = append(errs, fmt.Sprintf("copy %s failed, %s", path, err.Error()))
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	return errs
+}
+
+// nativeCopyFiles copies files and directories matching paths into output directory.
+func nativeCopyFiles(ctx context.Context, action *config.Action) error {
+	names, err := globPaths(expandEnvPaths(action.Paths))
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return errors.New(fmt.Sprintf("no file matches paths %s", strings.Join(action.Paths, ", ")))
+	}
+
+	dest, err := nativeOutputPath(action)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0744); err != nil {
+		return err
+	}
+	// Output directory may be under a source, e.g. when working directory is copied.
+	excluded := []string{dest, config.GetOutputDir()}
+	// Files from different directories may have the same name, e.g. logs of several products.
+	used := make(map[string]bool)
+	errs := make([]string, 0)
+	for _, name := range names {
+		target := filepath.Join(dest, uniqueName(filepath.Base(name), used))
+		errs = append(errs, copyTree(ctx, name, target, excluded)...)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return joinErrors(action, errs)
+}
+
+func formatOptional(v interface{}, err error) string {
+	if err != nil {
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
+// nativeProcessSnapshot writes running processes with CPU time, memory and handles.
+func nativeProcessSnapshot(ctx context.Context, action *config.Action) error {
+	ps, err := system.Processes()
+	if err != nil {
+		return err
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].PID < ps[j].PID })
+
+	return appendOutput(action, func(w io.Writer) error {
+		_, _ = fmt.Fprintln(w, "PID\tPPID\tName\tCPUTimeSec\tMemoryBytes\tHandles\tStartTime\tPath\tCmdline")
+		for _, p := range ps {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			p.FillDetail()
+			cpuTime, cpuErr := system.GetProcessCPUTime(p.PID)
+			memory, memErr := system.GetProcessMemoryInfo(p.PID)
+			handles, handlesErr := system.GetProcessHandleCount(p.PID)
+			created, createdErr := system.GetProcessCreateTime(p.PID)
+
+			usage := uint64(0)
+			if memErr == nil {
+				usage = memory.Usage()
+			}
+			_, err := fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.PID, p.PPID, p.Name,
+				formatOptional(fmt.Sprintf("%.2f", cpuTime.Seconds()), cpuErr),
+				formatOptional(usage, memErr),
+				formatOptional(handles, handlesErr),
+				formatOptional(created.Format(time.RFC3339), createdErr),
+				p.Exe, p.Cmdline)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// environmentAllowList are environment variables whose values are written by system_info, values of others
+// may hold credentials, e.g. tokens of CI agents, so only their names are written.
+var environmentAllowList = map[string]bool{
+	"PATH": true, "PATHEXT": true, "OS": true, "COMPUTERNAME": true, "HOSTNAME": true, "USERNAME": true,
+	"USER": true, "USERDOMAIN": true, "HOME": true, "USERPROFILE": true, "SHELL": true, "COMSPEC": true,
+	"TEMP": true, "TMP": true, "TMPDIR": true, "LANG": true, "LC_ALL": true, "TZ": true,
+	"SYSTEMROOT": true, "SYSTEMDRIVE": true, "WINDIR": true, "PROGRAMFILES": true, "PROGRAMFILES(X86)": true,
+	"PROGRAMDATA": true, "NUMBER_OF_PROCESSORS": true, "PROCESSOR_ARCHITECTURE": true, "PROCESSOR_IDENTIFIER": true,
+}
+
+// redactEnvironment sorts NAME=value pairs and replaces values of variables not in allow list.
+func redactEnvironment(env []string) []string {
+	results := make([]string, 0, len(env))
+	for _, kv := range env {
+		// Windows keeps per-drive directories in variables like "=C:", so "=" is searched after the first character.
+		if len(kv) < 2 {
+			continue
+		}
+		i := strings.Index(kv[1:], "=") + 1
+		if i == 0 {
+			continue
+		}
+		if !environmentAllowList[strings.ToUpper(kv[:i])] {
+			kv = kv[:i] + "=<redacted>"
+		}
+		results = append(results, kv)
+	}
+	sort.Strings(results)
+	return results
+}
+
+// nativeSystemInfo writes host, platform, memory and environment variables.
+func nativeSystemInfo(ctx context.Context, action *config.Action) error {
+	return appendOutput(action, func(w io.Writer) error {
+		line := func(name string, value interface{}, err error) {
+			if err != nil {
+				value = "<error: " + err.Error() + ">"
+			}
+			_, _ = fmt.Fprintf(w, "%s: %v\n", name, value)
+		}
+
+		line("os_arch", runtime.GOOS+"/"+runtime.GOARCH, nil)
+		line("cpu_logical_cores", runtime.NumCPU(), nil)
+		if info, err := metric.GetHostInfo(); err != nil {
+			line("host", nil, err)
+		} else {
+			line("hostname", info.Hostname, nil)
+			line("platform", strings.TrimSpace(info.Platform+" "+info.PlatformVersion), nil)
+			line("kernel", strings.TrimSpace(info.KernelVersion+" "+info.KernelArch), nil)
+			line("boot_time", time.Unix(int64(info.BootTime), 0).Format(time.RFC3339), nil)
+			line("uptime_sec", info.Uptime, nil)
+			line("virtualization", strings.TrimSpace(info.VirtualizationSystem+" "+info.VirtualizationRole), nil)
+		}
+		if available, total, err := metric.GetMemoryAvailableByte(); err != nil {
+			line("memory", nil, err)
+		} else {
+			line("memory_total_bytes", total, nil)
+			line("memory_available_bytes", available, nil)
+		}
+		if used, total, err := metric.GetSwapUsageByte(); err != nil {
+			line("swap", nil, err)
+		} else {
+			line("swap_total_bytes", total, nil)
+			line("swap_used_bytes", used, nil)
+		}
+		exe, err := os.Executable()
+		line("executable", exe, err)
+		wd, err := os.Getwd()
+		line("working_dir", wd, err)
+
+		_, _ = fmt.Fprintln(w, "[environment]")
+		for _, kv := range redactEnvironment(os.Environ()) {
+			_, _ = fmt.Fprintln(w, kv)
+		}
+		return nil
+	})
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// nativeDirectoryListing writes files under paths with size, modification time and SHA-256 hash.
+func nativeDirectoryListing(ctx context.Context, action *config.Action) error {
+	names, err := globPaths(expandEnvPaths(action.Paths))
+	if err != nil {
+		return err
+	}
+
+	errs := make([]string, 0)
+	err = appendOutput(action, func(w io.Writer) error {
+		_, _ = fmt.Fprintln(w, "Path\tSize\tModTime\tSHA256")
+		for _, name := range names {
+			err := filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err != nil {
+					errs = append(errs, err.Error())
+					return nil
+				}
+				size, hash := "<dir>", "-"
+				if !info.IsDir() {
+					size = fmt.Sprint(info.Size())
+					if info.Mode().IsRegular() {
+						if hash, err = hashFile(path); err != nil {
+							hash = "<error: " + err.Error() + ">"
+						}
+					}
+				}
+				_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", path, size, info.ModTime().Format(time.RFC3339), hash)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return joinErrors(action, errs)
+}
+
+// nativeCollectKeys writes values of registry keys on Windows or sysctl keys on Linux.
+func nativeCollectKeys(ctx context.Context, action *config.Action) error {
+	errs := make([]string, 0)
+	err := appendOutput(action, func(w io.Writer) error {
+		for _, key := range action.Paths {
+			_, _ = fmt.Fprintf(w, "[%s]\n", key)
+			values, err := system.ReadSystemKeys(key)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("read %s failed, %s", key, err.Error()))
+				_, _ = fmt.Fprintf(w, "<error: %s>\n", err.Error())
+				continue
+			}
+			names := make([]string, 0, len(values))
+			for name := range values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				_, _ = fmt.Fprintf(w, "%s = %s\n", name, values[name])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return joinErrors(action, errs)
+}
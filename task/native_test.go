@@ -0,0 +1,52 @@
+package task
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputPathUnder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "output")
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{"system_info.txt", true},
+		{"files", true},
+		{"a..b.txt", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../evil.txt", false},
+		{filepath.Join("..", "output2", "evil.txt"), false},
+		{filepath.Join("sub", "..", ".."), false},
+	}
+	for _, c := range cases {
+		p, err := outputPathUnder(dir, c.name)
+		if c.valid && (err != nil || p != filepath.Join(dir, c.name)) {
+			t.Errorf("outputPathUnder(%q) = %s, error %v", c.name, p, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("outputPathUnder(%q) = %s, should return error", c.name, p)
+		}
+	}
+
+	for name, want := range map[string]bool{"": true, "keys.txt": true, "..": false, "../x": false,
+		`..\x`: false, "sub/x": false, `C:x`: false, "/etc/passwd": false} {
+		if got := IsValidNativeOutput(name); got != want {
+			t.Errorf("IsValidNativeOutput(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRedactEnvironment(t *testing.T) {
+	env := []string{"Path=/usr/bin", "GITHUB_TOKEN=ghp_secret", "=C:=C:\\work", "AWS_SECRET_ACCESS_KEY=a=b",
+		"ComputerName=host1", "EMPTY=", "broken"}
+	got := redactEnvironment(env)
+	want := []string{"=C:=<redacted>", "AWS_SECRET_ACCESS_KEY=<redacted>", "ComputerName=host1", "EMPTY=<redacted>",
+		"GITHUB_TOKEN=<redacted>", "Path=/usr/bin"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("redactEnvironment = %q, want %q", got, want)
+	}
+}
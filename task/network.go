@@ -0,0 +1,146 @@
+package task
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"scp_delegator/config"
+	"scp_delegator/logger"
+	"sync"
+	"time"
+)
+
+// DefaultProbeTimeoutMS is timeout of network probes if criteria doesn't give one.
+const DefaultProbeTimeoutMS = 5000
+
+// NetworkCriteria lists criteria types which probe Target of criteria.
+// Probes run in background, so a check returns result of the probe started by previous check.
+var NetworkCriteria = map[string]bool{
+	"TCPLatency":    true,
+	"DNSResolution": true,
+	"HTTPStatus":    true,
+	"HTTPLatency":   true,
+}
+
+func probeTimeout(c *config.ConditionCriteria) time.Duration {
+	if c.TimeoutMS == 0 {
+		return DefaultProbeTimeoutMS * time.Millisecond
+	}
+	return time.Duration(c.TimeoutMS) * time.Millisecond
+}
+
+// latencyResult is milliseconds elapsed since start, or infinity if probe failed.
+func latencyResult(start time.Time, err error, c *config.ConditionCriteria) *CheckResult {
+	if err != nil {
+		logger.Wrapper.LogDebug("Probe failed, type=%s, ID=%d, target=%s, error=%s", c.Type, c.ID, c.Target, err.Error())
+		return valueResult(math.Inf(1), c)
+	}
+	return valueResult(float64(time.Since(start))/float64(time.Millisecond), c)
+}
+
+// probeState runs probes of a criterion in background, so slow or unreachable targets don't hold other criteria
+// of inspector for their timeouts.
+type probeState struct {
+	mutex   sync.Mutex
+	running bool
+	result  *CheckResult
+}
+
+// backgroundProbe returns result of the latest finished probe and starts next probe unless one is still running.
+// Each result is returned once, it returns nil if no probe finished since previous check.
+func backgroundProbe(ctx *CheckContext, c *config.ConditionCriteria, probe func(c *config.ConditionCriteria) *CheckResult) (*CheckResult, error) {
+	st, err := ctx.State(c, func() (interface{}, error) {
+		return &probeState{}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := st.(*probeState)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.running {
+		p.running = true
+		go func() {
+			r := probe(c)
+			p.mutex.Lock()
+			p.result, p.running = r, false
+			p.mutex.Unlock()
+		}()
+	}
+	r := p.result
+	p.result = nil
+	return r, nil
+}
+
+// probeTCPLatency measures milliseconds to establish TCP connection with target host:port.
+func probeTCPLatency(c *config.ConditionCriteria) *CheckResult {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", c.Target, probeTimeout(c))
+	if err == nil {
+		_ = conn.Close()
+	}
+	return latencyResult(start, err, c)
+}
+
+// probeDNSResolution measures milliseconds to resolve target host name.
+func probeDNSResolution(c *config.ConditionCriteria) *CheckResult {
+	host := c.Target
+	if h, _, err := net.SplitHostPort(c.Target); err == nil {
+		host = h
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), probeTimeout(c))
+	defer cancel()
+	start := time.Now()
+	_, err := net.DefaultResolver.LookupHost(timeout, host)
+	return latencyResult(start, err, c)
+}
+
+func probeHTTP(c *config.ConditionCriteria) (int, time.Duration, error) {
+	client := &http.Client{Timeout: probeTimeout(c)}
+	start := time.Now()
+	resp, err := client.Get(c.Target)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	// Latency includes body, read at most 1 MB of it.
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, time.Since(start), nil
+}
+
+// probeHTTPStatus is status code of GET request to target URL, or 0 if request failed.
+func probeHTTPStatus(c *config.ConditionCriteria) *CheckResult {
+	status, _, err := probeHTTP(c)
+	if err != nil {
+		logger.Wrapper.LogDebug("Probe failed, type=%s, ID=%d, target=%s, error=%s", c.Type, c.ID, c.Target, err.Error())
+	}
+	return valueResult(float64(status), c)
+}
+
+// probeHTTPLatency measures milliseconds of GET request to target URL, or infinity if request failed.
+func probeHTTPLatency(c *config.ConditionCriteria) *CheckResult {
+	start := time.Now()
+	_, _, err := probeHTTP(c)
+	return latencyResult(start, err, c)
+}
+
+func ConditionCheckerTCPLatency(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	return backgroundProbe(ctx, c, probeTCPLatency)
+}
+
+func ConditionCheckerDNSResolution(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	return backgroundProbe(ctx, c, probeDNSResolution)
+}
+
+func ConditionCheckerHTTPStatus(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	return backgroundProbe(ctx, c, probeHTTPStatus)
+}
+
+func ConditionCheckerHTTPLatency(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	return backgroundProbe(ctx, c, probeHTTPLatency)
+}
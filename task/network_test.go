@@ -0,0 +1,173 @@
+package task
+
+import (
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"scp_delegator/constant"
+	"scp_delegator/logger"
+	"testing"
+	"time"
+)
+
+// useTestLog writes log into temporary directory of test instead of output directory under the package.
+func useTestLog(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), constant.LogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Wrapper.SetOutput(f)
+	t.Cleanup(func() {
+		// Background probes may still log after test ends.
+		logger.Wrapper.SetOutput(ioutil.Discard)
+		_ = f.Close()
+	})
+}
+
+// closedAddress returns address of a port which refuses connection.
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+// slowServer answers after delay, or when test ends.
+func slowServer(t *testing.T, delay time.Duration) *httptest.Server {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-done:
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		s.Close()
+	})
+	return s
+}
+
+func TestProbeTCPLatency(t *testing.T) {
+	useTestLog(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c := &config.ConditionCriteria{ID: 1, Type: "TCPLatency", Target: l.Addr().String(), TimeoutMS: 1000, Operator: "<", Threshold: config.Threshold{Value: 1000}}
+	if r := probeTCPLatency(c); math.IsInf(r.Value, 1) || !r.Satisfied {
+		t.Errorf("latency of listening port = %v, satisfied %v", r.Value, r.Satisfied)
+	}
+
+	c.Target = closedAddress(t)
+	if r := probeTCPLatency(c); !math.IsInf(r.Value, 1) || r.Satisfied {
+		t.Errorf("latency of refused port = %v, want infinity", r.Value)
+	}
+
+	// Address of TEST-NET-1 isn't routed, the probe fails by timeout or unreachable network.
+	c.Target, c.TimeoutMS = "192.0.2.1:9", 200
+	start := time.Now()
+	if r := probeTCPLatency(c); !math.IsInf(r.Value, 1) {
+		t.Errorf("latency of unreachable address = %v, want infinity", r.Value)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("probe of unreachable address takes %s, timeout is not applied", elapsed)
+	}
+}
+
+func TestProbeHTTPStatus(t *testing.T) {
+	useTestLog(t)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	cases := []struct {
+		target string
+		status float64
+	}{
+		{s.URL + "/", 200},
+		{s.URL + "/missing", 404},
+		{"http://" + closedAddress(t) + "/", 0},
+		{slowServer(t, 5*time.Second).URL + "/", 0},
+	}
+	for _, tc := range cases {
+		c := &config.ConditionCriteria{ID: 1, Type: "HTTPStatus", Target: tc.target, TimeoutMS: 200, Operator: "==", Threshold: config.Threshold{Value: 200}}
+		start := time.Now()
+		r := probeHTTPStatus(c)
+		if r.Value != tc.status || r.Satisfied != (tc.status == 200) {
+			t.Errorf("status of %s = %v, satisfied %v, want %v", tc.target, r.Value, r.Satisfied, tc.status)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("probe of %s takes %s, timeout is not applied", tc.target, elapsed)
+		}
+	}
+}
+
+func TestProbeHTTPLatency(t *testing.T) {
+	useTestLog(t)
+	s := slowServer(t, 50*time.Millisecond)
+	c := &config.ConditionCriteria{ID: 1, Type: "HTTPLatency", Target: s.URL, TimeoutMS: 2000, Operator: ">", Threshold: config.Threshold{Value: 40}}
+	if r := probeHTTPLatency(c); r.Value < 50 || math.IsInf(r.Value, 1) || !r.Satisfied {
+		t.Errorf("latency of slow server = %v, satisfied %v", r.Value, r.Satisfied)
+	}
+
+	c.Target = "http://" + closedAddress(t)
+	if r := probeHTTPLatency(c); !math.IsInf(r.Value, 1) || !r.Satisfied {
+		t.Errorf("latency of refused server = %v, want infinity", r.Value)
+	}
+
+	c.Target, c.TimeoutMS = slowServer(t, 5*time.Second).URL, 100
+	start := time.Now()
+	if r := probeHTTPLatency(c); !math.IsInf(r.Value, 1) {
+		t.Errorf("latency of timed out request = %v, want infinity", r.Value)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("probe takes %s, timeout is not applied", elapsed)
+	}
+}
+
+func TestBackgroundProbe(t *testing.T) {
+	useTestLog(t)
+	s := slowServer(t, 300*time.Millisecond)
+	ctx := &CheckContext{}
+	c := &config.ConditionCriteria{ID: 1, Type: "HTTPStatus", Target: s.URL, TimeoutMS: 2000, Operator: "==", Threshold: config.Threshold{Value: 200}}
+
+	start := time.Now()
+	r, err := ConditionCheckerHTTPStatus(ctx, c)
+	if err != nil || r != nil {
+		t.Fatalf("first check = %v, %v, want no result while probe is running", r, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("check is blocked by probe for %s", elapsed)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for r == nil && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		if r, err = ConditionCheckerHTTPStatus(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r == nil || r.Value != 200 || !r.Satisfied {
+		t.Fatalf("result of finished probe = %v, want status 200", r)
+	}
+	// The result is consumed, next one comes from the probe started by this check.
+	if r, _ = ConditionCheckerHTTPStatus(ctx, c); r != nil {
+		t.Errorf("result of probe is returned twice")
+	}
+}
@@ -0,0 +1,285 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"scp_delegator/config"
+	"scp_delegator/logger"
+	"sync"
+	"time"
+)
+
+// Stream names of command output.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// outputFile appends output of command to a file under output directory as soon as it is written.
+// If maxSize is positive the file is rotated when it would exceed maxSize and rotation keeps that many old files,
+// or output beyond maxSize is dropped if rotation is zero.
+type outputFile struct {
+	mutex    sync.Mutex
+	path     string
+	maxSize  int64
+	rotation uint32
+
+	f         *os.File
+	size      int64
+	truncated bool
+}
+
+func openOutputFile(name string, maxSize int64, rotation uint32) (*outputFile, error) {
+	o := &outputFile{
+		path:     filepath.Join(config.GetOutputDir(), name),
+		maxSize:  maxSize,
+		rotation: rotation,
+	}
+	if err := o.open(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *outputFile) open() error {
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	o.f, o.size = f, info.Size()
+	return nil
+}
+
+// rotate renames file to file.1, file.1 to file.2 and so on, the oldest one is removed.
+func (o *outputFile) rotate() error {
+	if err := o.f.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d", o.path, o.rotation))
+	for i := o.rotation - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", o.path, i), fmt.Sprintf("%s.%d", o.path, i+1))
+	}
+	if err := os.Rename(o.path, o.path+".1"); err != nil {
+		return err
+	}
+	return o.open()
+}
+
+// Write writes p entirely unless output is truncated, in which case the dropped part is still reported as written
+// so the command isn't blocked or failed.
+func (o *outputFile) Write(p []byte) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.maxSize <= 0 {
+		n, err := o.f.Write(p)
+		o.size += int64(n)
+		return n, err
+	}
+
+	data := p
+	for len(data) > 0 {
+		remain := o.maxSize - o.size
+		if remain <= 0 {
+			if o.rotation == 0 {
+				if !o.truncated {
+					o.truncated = true
+					_, _ = fmt.Fprintf(o.f, "\n[output truncated at %d bytes]\n", o.maxSize)
+				}
+				return len(p), nil
+			}
+			if err := o.rotate(); err != nil {
+				return len(p) - len(data), err
+			}
+			continue
+		}
+		if o.rotation > 0 && o.size > 0 && int64(len(data)) > remain {
+			// Start a new file rather than splitting the write, unless it exceeds the limit itself.
+			if err := o.rotate(); err != nil {
+				return len(p) - len(data), err
+			}
+			continue
+		}
+		chunk := data
+		if int64(len(chunk)) > remain {
+			chunk = data[:remain]
+		}
+		n, err := o.f.Write(chunk)
+		o.size += int64(n)
+		data = data[n:]
+		if err != nil {
+			return len(p) - len(data), err
+		}
+	}
+	return len(p), nil
+}
+
+// Truncated reports whether any output is dropped.
+func (o *outputFile) Truncated() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.truncated
+}
+
+func (o *outputFile) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.f.Close()
+}
+
+// maxLine is the longest partial line kept by lineSplitter, longer output without line end,
+// e.g. progress bar or binary, is split into pieces.
+const maxLine = 64 * 1024
+
+// lineSplitter passes each line of a stream to emit, partial line is kept until it ends or Flush is called.
+type lineSplitter struct {
+	emit    func(line []byte) error
+	partial []byte
+}
+
+func (s *lineSplitter) Write(p []byte) (int, error) {
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := s.partial[:i+1]
+		s.partial = s.partial[i+1:]
+		if err := s.emit(line); err != nil {
+			return len(p), err
+		}
+	}
+	if len(s.partial) >= maxLine {
+		if err := s.Flush(); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush passes the remaining partial line.
+func (s *lineSplitter) Flush() error {
+	if len(s.partial) == 0 {
+		return nil
+	}
+	line := s.partial
+	s.partial = nil
+	return s.emit(line)
+}
+
+// newLineTagger prefixes each line of stream with time and stream name.
+func newLineTagger(w io.Writer, stream string) *lineSplitter {
+	return &lineSplitter{emit: func(line []byte) error {
+		// Each line is written by a single call, so lines of stdout and stderr don't interleave.
+		buf := make([]byte, 0, len(line)+48)
+		buf = append(buf, time.Now().Format("2006-01-02T15:04:05.000Z07:00")...)
+		buf = append(buf, " ["+stream+"] "...)
+		buf = append(buf, line...)
+		if line[len(line)-1] != '\n' {
+			buf = append(buf, '\n')
+		}
+		_, err := w.Write(buf)
+		return err
+	}}
+}
+
+// countingWriter counts bytes written to stream.
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// commandOutput streams stdout and stderr of a command into output files of action, and output matcher if any.
+type commandOutput struct {
+	files     []*outputFile
+	splitters []*lineSplitter
+	stdout    *countingWriter
+	stderr    *countingWriter
+}
+
+// attachOutput opens output files of action and sets them as stdout and stderr of cmd,
+// streams without output file are discarded. Matcher is nil if action has no output pattern.
+func attachOutput(cmd *exec.Cmd, action *config.Action, matcher *outputMatcher) (*commandOutput, error) {
+	o := &commandOutput{}
+	opened := make(map[string]*outputFile)
+	stream := func(name string, stream string) (io.Writer, error) {
+		var w io.Writer = ioutil.Discard
+		if name != "" {
+			f, ok := opened[name]
+			if !ok {
+				var err error
+				f, err = openOutputFile(name, int64(action.MaxOutputMB)<<20, action.OutputRotation)
+				if err != nil {
+					return nil, err
+				}
+				opened[name] = f
+				o.files = append(o.files, f)
+			}
+			w = f
+			if action.TagOutput {
+				t := newLineTagger(f, stream)
+				o.splitters = append(o.splitters, t)
+				w = t
+			}
+		}
+		if matcher != nil {
+			m := &lineSplitter{emit: matcher.matchLine}
+			o.splitters = append(o.splitters, m)
+			w = io.MultiWriter(w, m)
+		}
+		return w, nil
+	}
+
+	errorOutput := action.ErrorOutput
+	if errorOutput == "" {
+		errorOutput = action.Output
+	}
+	stdout, err := stream(action.Output, StreamStdout)
+	if err == nil {
+		var stderr io.Writer
+		if stderr, err = stream(errorOutput, StreamStderr); err == nil {
+			o.stdout, o.stderr = &countingWriter{w: stdout}, &countingWriter{w: stderr}
+			cmd.Stdout, cmd.Stderr = o.stdout, o.stderr
+			return o, nil
+		}
+	}
+	o.close(nil)
+	return nil, err
+}
+
+// close flushes partial lines and closes output files, byte counts of streams are set to result if it isn't nil.
+func (o *commandOutput) close(r *ActionResult) {
+	for _, s := range o.splitters {
+		if err := s.Flush(); err != nil {
+			logger.Wrapper.LogError("Get error during writing output of action, error %s", err.Error())
+		}
+	}
+	for _, f := range o.files {
+		if r != nil && f.Truncated() {
+			r.OutputTruncated = true
+		}
+		if err := f.Close(); err != nil {
+			logger.Wrapper.LogError("Get error during closing file %s, error %s", f.path, err.Error())
+		}
+	}
+	if r != nil && o.stdout != nil {
+		r.StdoutBytes, r.StderrBytes = o.stdout.count, o.stderr.count
+	}
+}
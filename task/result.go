@@ -0,0 +1,81 @@
+package task
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"scp_delegator/constant"
+	"scp_delegator/logger"
+	"sync"
+	"time"
+)
+
+// ActionResult records an execution of action, it is appended as a JSON line to result file in output directory.
+// ExitCode is -1 if command didn't exit normally or action is native and failed.
+// Failure is the reason why success criteria of action aren't met.
+type ActionResult struct {
+	TaskID          uint32    `json:"task_id"`
+	ActionID        uint32    `json:"action_id"`
+	Name            string    `json:"name"`
+	Kind            string    `json:"kind"`
+	Command         string    `json:"command,omitempty"`
+	StartTime       time.Time `json:"start_time"`
+	DurationMS      int64     `json:"duration_ms"`
+	ExitCode        int       `json:"exit_code"`
+	Error           string    `json:"error,omitempty"`
+	StdoutBytes     int64     `json:"stdout_bytes"`
+	StderrBytes     int64     `json:"stderr_bytes"`
+	OutputTruncated bool      `json:"output_truncated"`
+	Succeeded       bool      `json:"succeeded"`
+	Failure         string    `json:"failure,omitempty"`
+}
+
+var actionResultMutex sync.Mutex
+
+func newActionResult(taskID uint32, action *config.Action) *ActionResult {
+	return &ActionResult{
+		TaskID:    taskID,
+		ActionID:  action.ID,
+		Name:      action.Name,
+		Kind:      actionKind(action),
+		StartTime: time.Now(),
+		ExitCode:  -1,
+	}
+}
+
+// finish sets duration and error of result, checks success criteria of action and appends result to result file.
+// Matcher is nil if action has no output pattern.
+func (r *ActionResult) finish(err error, action *config.Action, m *outputMatcher) {
+	r.DurationMS = int64(time.Since(r.StartTime) / time.Millisecond)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if failure := checkSuccess(action, r, m); failure != nil {
+		r.Failure = failure.Error()
+		logger.Wrapper.LogInfo("Action %d failed in %d ms with exit code %d, %s", r.ActionID, r.DurationMS, r.ExitCode, r.Failure)
+	} else {
+		r.Succeeded = true
+		logger.Wrapper.LogInfo("Action %d succeeded in %d ms with exit code %d", r.ActionID, r.DurationMS, r.ExitCode)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		logger.Wrapper.LogError("Can't marshal result of action %d, error %s", r.ActionID, err.Error())
+		return
+	}
+
+	// Tasks may run concurrently.
+	actionResultMutex.Lock()
+	defer actionResultMutex.Unlock()
+	p := filepath.Join(config.GetOutputDir(), constant.ActionResultFileName)
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Wrapper.LogError("Get error during opening file %s, error %s", p, err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		logger.Wrapper.LogError("Get error during writing file %s, error %s", p, err.Error())
+	}
+}
@@ -0,0 +1,112 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"scp_delegator/config"
+	"strings"
+	"sync"
+)
+
+// outputMatcher checks each line of stdout and stderr with required and forbidden patterns of action.
+type outputMatcher struct {
+	mutex     sync.Mutex
+	required  *regexp.Regexp
+	forbidden *regexp.Regexp
+
+	requiredFound bool
+	forbiddenLine string
+}
+
+// newOutputMatcher returns nil if action has no output pattern.
+func newOutputMatcher(action *config.Action) (*outputMatcher, error) {
+	if action.RequiredOutput == "" && action.ForbiddenOutput == "" {
+		return nil, nil
+	}
+	m := &outputMatcher{}
+	var err error
+	if action.RequiredOutput != "" {
+		if m.required, err = regexp.Compile(action.RequiredOutput); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid required output pattern, %s", err.Error()))
+		}
+	}
+	if action.ForbiddenOutput != "" {
+		if m.forbidden, err = regexp.Compile(action.ForbiddenOutput); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid forbidden output pattern, %s", err.Error()))
+		}
+	}
+	return m, nil
+}
+
+func (m *outputMatcher) matchLine(line []byte) error {
+	line = bytes.TrimRight(line, "\r\n")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.required != nil && !m.requiredFound && m.required.Match(line) {
+		m.requiredFound = true
+	}
+	if m.forbidden != nil && m.forbiddenLine == "" && m.forbidden.Match(line) {
+		m.forbiddenLine = string(line)
+	}
+	return nil
+}
+
+// checkSuccess returns reason why action is regarded as failed, or nil if it succeeded.
+// Matcher is nil if action has no output pattern.
+func checkSuccess(action *config.Action, r *ActionResult, m *outputMatcher) error {
+	if !isSuccessExitCode(action, r.ExitCode) {
+		if r.Error != "" {
+			return errors.New(r.Error)
+		}
+		return errors.New(fmt.Sprintf("exit code %d is not accepted", r.ExitCode))
+	}
+	if m != nil {
+		if m.required != nil && !m.requiredFound {
+			return errors.New(fmt.Sprintf("no output matches required pattern %s", m.required.String()))
+		}
+		if m.forbiddenLine != "" {
+			return errors.New(fmt.Sprintf("output matches forbidden pattern %s, line %q", m.forbidden.String(), m.forbiddenLine))
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, p := range requiredFilePatterns(action) {
+		names, err := globPaths([]string{p})
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New(fmt.Sprintf("required files not found: %s", strings.Join(missing, ", ")))
+	}
+	return nil
+}
+
+func isSuccessExitCode(action *config.Action, code int) bool {
+	if len(action.SuccessExitCodes) == 0 {
+		return code == 0
+	}
+	for _, c := range action.SuccessExitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredFilePatterns resolves relative patterns against output directory, where outputs of actions are written.
+func requiredFilePatterns(action *config.Action) []string {
+	patterns := expandEnvPaths(action.RequiredFiles)
+	for i, p := range patterns {
+		if !filepath.IsAbs(p) {
+			patterns[i] = filepath.Join(config.GetOutputDir(), p)
+		}
+	}
+	return patterns
+}
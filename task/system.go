@@ -0,0 +1,139 @@
+package task
+
+import (
+	"scp_delegator/config"
+	"scp_delegator/metric"
+	"time"
+)
+
+type counterSample struct {
+	value uint64
+	at    time.Time
+}
+
+// minCounterWindow is the shortest period a rate is computed over, shorter one is dominated by noise.
+const minCounterWindow = 100 * time.Millisecond
+
+// counterRate returns increment per second of an accumulated counter since previous check of criterion.
+// The first check only records a sample and isn't ready, so checking never blocks for the second sample.
+func counterRate(ctx *CheckContext, c *config.ConditionCriteria, read func() (uint64, error)) (float64, bool, error) {
+	first := false
+	st, err := ctx.State(c, func() (interface{}, error) {
+		v, err := read()
+		if err != nil {
+			return nil, err
+		}
+		first = true
+		return &counterSample{value: v, at: time.Now()}, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	last := st.(*counterSample)
+	if first || time.Since(last.at) < minCounterWindow {
+		return 0, false, nil
+	}
+
+	v, err := read()
+	if err != nil {
+		return 0, false, err
+	}
+	now := time.Now()
+	rate := 0.0
+	// Counter may be reset, for example an interface is reconnected.
+	if v >= last.value {
+		rate = float64(v-last.value) / now.Sub(last.at).Seconds()
+	}
+	last.value, last.at = v, now
+	return rate, true, nil
+}
+
+// cpuTimes is previous sample of CPU times kept per criterion,
+// so criteria with different intervals measure their own periods.
+type cpuTimes struct {
+	times metric.CpuTimes
+}
+
+// cpuUsage returns usage read by given function since previous check of criterion,
+// the first check returns average usage since boot.
+func cpuUsage(ctx *CheckContext, c *config.ConditionCriteria, read func(metric.CpuTimes) (float64, metric.CpuTimes, error)) (float64, error) {
+	st, err := ctx.State(c, func() (interface{}, error) {
+		return &cpuTimes{}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	last := st.(*cpuTimes)
+	usage, times, err := read(last.times)
+	if err != nil {
+		return 0, err
+	}
+	last.times = times
+	return usage, nil
+}
+
+func ConditionCheckerSystemCPU(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	usage, err := cpuUsage(ctx, c, metric.GetTotalCpuUsage)
+	if err != nil {
+		return nil, err
+	}
+	return capacityResult(usage, 100, c), nil
+}
+
+func ConditionCheckerSystemCPUCoreMax(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	usage, err := cpuUsage(ctx, c, metric.GetCpuCoreUsageMax)
+	if err != nil {
+		return nil, err
+	}
+	return capacityResult(usage, 100, c), nil
+}
+
+func ConditionCheckerSystemMemoryAvailable(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	available, total, err := metric.GetMemoryAvailableByte()
+	if err != nil {
+		return nil, err
+	}
+	return capacityResult(float64(available), float64(total), c), nil
+}
+
+func ConditionCheckerSystemSwapUsage(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	used, total, err := metric.GetSwapUsageByte()
+	if err != nil {
+		return nil, err
+	}
+	return capacityResult(float64(used), float64(total), c), nil
+}
+
+func ConditionCheckerSystemLoadAverage(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	avg, err := metric.GetLoadAverage()
+	if err != nil {
+		return nil, err
+	}
+	return valueResult(avg, c), nil
+}
+
+// ConditionCheckerDiskIORate is bytes per second read from and written to disks.
+func ConditionCheckerDiskIORate(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	rate, ready, err := counterRate(ctx, c, metric.GetDiskIOBytes)
+	if err != nil || !ready {
+		return nil, err
+	}
+	return valueResult(rate, c), nil
+}
+
+// ConditionCheckerNetworkThroughput is bytes per second sent and received by network interfaces.
+func ConditionCheckerNetworkThroughput(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	rate, ready, err := counterRate(ctx, c, metric.GetNetworkIOBytes)
+	if err != nil || !ready {
+		return nil, err
+	}
+	return valueResult(rate, c), nil
+}
+
+func ConditionCheckerSystemHandles(ctx *CheckContext, c *config.ConditionCriteria) (*CheckResult, error) {
+	count, err := metric.GetSystemHandleCount()
+	if err != nil {
+		return nil, err
+	}
+	return valueResult(float64(count), c), nil
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"errors"
+	"scp_delegator/config"
+	"testing"
+	"time"
+)
+
+func TestCounterRate(t *testing.T) {
+	ctx := &CheckContext{}
+	c := &config.ConditionCriteria{ID: 1, Type: "DiskIORate"}
+	counter := uint64(1000)
+	read := func() (uint64, error) { return counter, nil }
+
+	// The first check records sample without waiting for the second one.
+	start := time.Now()
+	if _, ready, err := counterRate(ctx, c, read); err != nil || ready {
+		t.Fatalf("first check is ready %v, error %v", ready, err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("first check blocks for %s", elapsed)
+	}
+	// Period too short to measure isn't ready either, and doesn't replace the sample.
+	if _, ready, err := counterRate(ctx, c, read); err != nil || ready {
+		t.Fatalf("check right after the first one is ready %v, error %v", ready, err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	counter += 1000
+	rate, ready, err := counterRate(ctx, c, read)
+	if err != nil || !ready {
+		t.Fatalf("second check is ready %v, error %v", ready, err)
+	}
+	if elapsed := time.Since(start); rate > 1000/0.2 || rate < 1000/elapsed.Seconds() {
+		t.Errorf("rate = %.0f, want 1000 per %s", rate, elapsed)
+	}
+
+	// Reset counter gives zero rate instead of overflow.
+	time.Sleep(minCounterWindow)
+	counter = 10
+	if rate, ready, err = counterRate(ctx, c, read); err != nil || !ready || rate != 0 {
+		t.Errorf("rate of reset counter = %v, ready %v, error %v", rate, ready, err)
+	}
+
+	// Criterion has its own sample.
+	other := &config.ConditionCriteria{ID: 2, Type: "DiskIORate"}
+	if _, ready, _ := counterRate(ctx, other, read); ready {
+		t.Error("first check of other criterion is ready")
+	}
+	failed := errors.New("failed")
+	if _, _, err := counterRate(ctx, &config.ConditionCriteria{ID: 3}, func() (uint64, error) { return 0, failed }); err != failed {
+		t.Errorf("error of reading counter is %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package task
+
+import (
+	"scp_delegator/config"
+)
+
+// defaultUnits are units of number thresholds without unit, for criteria types whose values are bytes.
+var defaultUnits = map[string]string{
+	"Memory":                "MB",
+	"DiskAvailableUsage":    "GB",
+	"FileSize":              "MB",
+	"DirectorySize":         "MB",
+	"SystemMemoryAvailable": "MB",
+	"SystemSwapUsage":       "MB",
+	"DiskIORate":            "KB",
+	"NetworkThroughput":     "KB",
+}
+
+// percentCriteria lists criteria types whose results carry total capacity, so percentage thresholds are supported.
+var percentCriteria = map[string]bool{
+	"CPU":                   true,
+	"Memory":                true,
+	"DiskAvailableUsage":    true,
+	"SystemCPU":             true,
+	"SystemCPUCoreMax":      true,
+	"SystemMemoryAvailable": true,
+	"SystemSwapUsage":       true,
+}
+
+// IsValidThresholdUnit reports whether threshold unit is supported by criteria type.
+func IsValidThresholdUnit(criteriaType string, unit string) bool {
+	switch unit {
+	case "":
+		return true
+	case config.UnitPercent:
+		return percentCriteria[criteriaType]
+	}
+	if _, ok := config.SizeUnits[unit]; !ok {
+		return false
+	}
+	_, ok := defaultUnits[criteriaType]
+	return ok
+}
+
+// thresholdOf resolves threshold of criteria in unit of checker value, total is capacity for percentage.
+func thresholdOf(c *config.ConditionCriteria, total float64) float64 {
+	t := c.Threshold
+	if t.Unit == config.UnitPercent {
+		return t.Value * total / 100
+	} else if t.Unit != "" {
+		return t.Value * config.SizeUnits[t.Unit]
+	}
+	if unit, ok := defaultUnits[c.Type]; ok {
+		return t.Value * config.SizeUnits[unit]
+	}
+	return t.Value
+}
+
+func satisfy(value float64, total float64, c *config.ConditionCriteria) bool {
+	return compareWithOperator(value, thresholdOf(c, total), c.Operator)
+}
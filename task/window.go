@@ -0,0 +1,133 @@
+package task
+
+import (
+	"math"
+	"scp_delegator/config"
+	"sort"
+	"time"
+)
+
+// Window functions evaluate samples of a criterion over its sliding window.
+const (
+	WindowFunctionAvg  = "avg"
+	WindowFunctionP95  = "p95"
+	WindowFunctionMax  = "max"
+	WindowFunctionMin  = "min"
+	WindowFunctionRate = "rate"
+)
+
+// WindowFunctions lists all supported window functions, empty function means point sample.
+var WindowFunctions = []string{WindowFunctionAvg, WindowFunctionP95, WindowFunctionMax, WindowFunctionMin, WindowFunctionRate}
+
+// IsValidWindowFunction reports whether function is supported by sampleWindow.
+func IsValidWindowFunction(function string) bool {
+	if function == "" {
+		return true
+	}
+	for _, f := range WindowFunctions {
+		if f == function {
+			return true
+		}
+	}
+	return false
+}
+
+// criterionInterval returns sampling interval of criterion, at least one second.
+func criterionInterval(c *config.ConditionCriteria) time.Duration {
+	if c.Interval == 0 {
+		return time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+// sampleWindow is a ring buffer holds samples of latest window of a criterion.
+type sampleWindow struct {
+	function string
+	samples  []sample
+	next     int
+	count    int
+}
+
+func newSampleWindow(c *config.ConditionCriteria) *sampleWindow {
+	interval := criterionInterval(c)
+	window := time.Duration(c.WindowS) * time.Second
+	// Both ends of window are included.
+	capacity := int(window/interval) + 1
+	if capacity < 2 {
+		capacity = 2
+	}
+	return &sampleWindow{
+		function: c.Function,
+		samples:  make([]sample, capacity),
+	}
+}
+
+func (w *sampleWindow) push(at time.Time, value float64) {
+	w.samples[w.next] = sample{at: at, value: value}
+	w.next = (w.next + 1) % len(w.samples)
+	if w.count < len(w.samples) {
+		w.count++
+	}
+}
+
+// ordered returns samples from oldest to newest.
+func (w *sampleWindow) ordered() []sample {
+	results := make([]sample, 0, w.count)
+	start := (w.next - w.count + len(w.samples)) % len(w.samples)
+	for n := 0; n < w.count; n++ {
+		results = append(results, w.samples[(start+n)%len(w.samples)])
+	}
+	return results
+}
+
+// evaluate applies window function to samples, it is not ready until window is filled.
+func (w *sampleWindow) evaluate() (float64, bool) {
+	if w.count < len(w.samples) {
+		return 0, false
+	}
+	samples := w.ordered()
+
+	switch w.function {
+	case WindowFunctionAvg:
+		sum := 0.0
+		for _, s := range samples {
+			sum += s.value
+		}
+		return sum / float64(len(samples)), true
+	case WindowFunctionP95:
+		values := make([]float64, 0, len(samples))
+		for _, s := range samples {
+			values = append(values, s.value)
+		}
+		sort.Float64s(values)
+		// Nearest-rank percentile.
+		rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+		return values[rank], true
+	case WindowFunctionMax:
+		max := samples[0].value
+		for _, s := range samples[1:] {
+			max = math.Max(max, s.value)
+		}
+		return max, true
+	case WindowFunctionMin:
+		min := samples[0].value
+		for _, s := range samples[1:] {
+			min = math.Min(min, s.value)
+		}
+		return min, true
+	case WindowFunctionRate:
+		// Change per second between oldest and newest samples.
+		first, last := samples[0], samples[len(samples)-1]
+		elapsed := last.at.Sub(first.at).Seconds()
+		if elapsed <= 0 {
+			return 0, false
+		}
+		return (last.value - first.value) / elapsed, true
+	}
+	return 0, false
+}
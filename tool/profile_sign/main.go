@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"scp_delegator/constant"
+	"scp_delegator/crypto"
+)
+
+// profile_sign generates signing key pair and signs profile for delegator.
+//
+//	profile_sign -genkey -key signing.key -pub profile.pub
+//	profile_sign -key signing.key -profile profile.json
+func main() {
+	genKey := flag.Bool("genkey", false, "generate Ed25519 key pair")
+	keyPath := flag.String("key", "signing.key", "private key path")
+	pubPath := flag.String("pub", constant.ProfilePublicKeyName, "public key output path of -genkey")
+	profilePath := flag.String("profile", constant.ProfileName, "profile to sign")
+	sigPath := flag.String("sig", "", "signature output path, default is <profile>.sig")
+	flag.Parse()
+
+	if *genKey {
+		priv, pub, err := crypto.GenerateSigningKey()
+		if err != nil {
+			exit("Generate key failed with error %s", err)
+		}
+		if err := ioutil.WriteFile(*keyPath, priv, 0600); err != nil {
+			exit("Write private key failed with error %s", err)
+		}
+		if err := ioutil.WriteFile(*pubPath, pub, 0644); err != nil {
+			exit("Write public key failed with error %s", err)
+		}
+		fmt.Printf("Key pair generated, private key %s, public key %s\n", *keyPath, *pubPath)
+		return
+	}
+
+	s, err := ioutil.ReadFile(*keyPath)
+	if err != nil {
+		exit("Read private key failed with error %s", err)
+	}
+	key, err := crypto.ParseSigningPrivateKey(s)
+	if err != nil {
+		exit("Parse private key failed with error %s", err)
+	}
+
+	profile, err := ioutil.ReadFile(*profilePath)
+	if err != nil {
+		exit("Read profile failed with error %s", err)
+	}
+	sig, err := crypto.SignProfile(profile, key)
+	if err != nil {
+		exit("Sign profile failed with error %s", err)
+	}
+
+	if *sigPath == "" {
+		*sigPath = *profilePath + ".sig"
+	}
+	if err := ioutil.WriteFile(*sigPath, sig, 0644); err != nil {
+		exit("Write signature failed with error %s", err)
+	}
+	fmt.Printf("Profile %s signed, signature %s\n", *profilePath, *sigPath)
+}
+
+func exit(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"scp_delegator/crypto"
+	"scp_delegator/zip"
+	"strings"
+)
+
+// scp_decrypt generates recipient key pair and decrypts artifacts uploaded by delegator.
+//
+//	scp_decrypt -genkey -key recipient.key -pub recipient.pub
+//	scp_decrypt -key recipient.key [-extract <dir>] <segment>.enc ...
+func main() {
+	genKey := flag.Bool("genkey", false, "generate RSA key pair")
+	bits := flag.Int("bits", 3072, "RSA key size of -genkey")
+	keyPath := flag.String("key", "recipient.key", "recipient private key path")
+	pubPath := flag.String("pub", "recipient.pub", "recipient public key output path of -genkey")
+	extractDir := flag.String("extract", "", "extract decrypted segments into directory")
+	flag.Parse()
+
+	if *genKey {
+		priv, pub, err := crypto.GenerateRecipientKey(*bits)
+		if err != nil {
+			exit("Generate key failed with error %s", err)
+		}
+		if err := ioutil.WriteFile(*keyPath, priv, 0600); err != nil {
+			exit("Write private key failed with error %s", err)
+		}
+		if err := ioutil.WriteFile(*pubPath, pub, 0644); err != nil {
+			exit("Write public key failed with error %s", err)
+		}
+		fmt.Printf("Key pair generated, private key %s, public key %s\n", *keyPath, *pubPath)
+		return
+	}
+
+	if flag.NArg() == 0 {
+		exit("No encrypted file given")
+	}
+
+	s, err := ioutil.ReadFile(*keyPath)
+	if err != nil {
+		exit("Read private key failed with error %s", err)
+	}
+	key, err := crypto.ParseRecipientPrivateKey(s)
+	if err != nil {
+		exit("Parse private key failed with error %s", err)
+	}
+
+	decrypted := make([]string, 0, flag.NArg())
+	for _, src := range flag.Args() {
+		dst := strings.TrimSuffix(src, crypto.EncryptedFileSuffix)
+		if dst == src {
+			dst = src + ".dec"
+		}
+		if err := crypto.DecryptFile(src, dst, key); err != nil {
+			exit("Decrypt %s failed with error %s", src, err)
+		}
+		fmt.Printf("Decrypted %s to %s\n", src, dst)
+		decrypted = append(decrypted, dst)
+	}
+
+	if *extractDir != "" {
+		ctx := context.Background()
+		files, err := zip.Decompress(&ctx, decrypted, *extractDir, nil)
+		if err != nil {
+			exit("Extract failed with error %s", err)
+		}
+		fmt.Printf("Extracted %d files to %s\n", len(files), *extractDir)
+	}
+}
+
+func exit(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
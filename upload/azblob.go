@@ -0,0 +1,238 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"scp_delegator/logger"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRetryDelayS    = 4
+	DefaultMaxRetryDelayS = 120
+	DefaultBlockSizeMB    = 4
+	DefaultParallelism    = 4
+)
+
+type azBlobUploader struct {
+	cfg *config.Upload
+}
+
+func newAzBlobUploader(cfg *config.Upload) Uploader {
+	return &azBlobUploader{cfg: cfg}
+}
+
+func (u *azBlobUploader) PutFile(ctx *context.Context, filePath string) *Result {
+	return PutFileToAzBlob(ctx, u.cfg, filePath)
+}
+
+// PutFileToAzBlob will upload file to Azure blob by staging blocks and committing block list.
+// Staged blocks are recorded in upload journal, so a rerun only stages remaining blocks.
+func PutFileToAzBlob(ctx *context.Context, cfg *config.Upload, filePath string) *Result {
+	uploadCtx, cancelFunc := context.WithTimeout(*ctx, time.Second*time.Duration(cfg.TimeoutS))
+	defer cancelFunc()
+
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errorResult(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return errorResult(err)
+	}
+
+	// Prepare upload URL, pipeline, and options
+	pipe := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{
+		Retry:      composeRetryOptions(cfg),
+		HTTPSender: newPipelineSender(cfg),
+	})
+	url, err := url.Parse(composeAzBlobURL(cfg, filePath))
+	if err != nil {
+		return errorResult(err)
+	}
+	blobURL := azblob.NewBlockBlobURL(*url, pipe)
+	return putBlockBlob(uploadCtx, cfg, blobURL, file, info)
+}
+
+// putBlockBlob stages blocks of file which are not recorded in journal yet, then commits block list.
+func putBlockBlob(ctx context.Context, cfg *config.Upload, blobURL azblob.BlockBlobURL, file *os.File, info os.FileInfo) *Result {
+	// SAS token may be renewed between runs, so it is not part of journal.
+	noSAS := blobURL.URL()
+	noSAS.RawQuery = ""
+	j := getJournal()
+	entry := j.begin(file.Name(), noSAS.String(), info, DefaultBlockSizeMB<<20)
+
+	if len(entry.StagedBlocks) > 0 {
+		// Uncommitted blocks may be discarded by service, e.g. garbage collected after a week.
+		uncommitted := map[string]bool{}
+		list, err := blobURL.GetBlockList(ctx, azblob.BlockListUncommitted, azblob.LeaseAccessConditions{})
+		if err == nil {
+			for _, b := range list.UncommittedBlocks {
+				uncommitted[b.Name] = true
+			}
+		}
+		j.retain(entry, func(index int) bool {
+			return uncommitted[composeBlockID(index)]
+		})
+		logger.Wrapper.LogInfo("Resume uploading %s, %d blocks already staged", file.Name(), len(entry.StagedBlocks))
+	}
+
+	count := int((info.Size() + entry.BlockSize - 1) / entry.BlockSize)
+	if err := stageBlocks(ctx, cfg, blobURL, file, entry, count); err != nil {
+		return errorResult(err)
+	}
+
+	blockIDs := make([]string, count)
+	for i := range blockIDs {
+		blockIDs[i] = composeBlockID(i)
+	}
+	response, err := blobURL.CommitBlockList(ctx, blockIDs, azblob.BlobHTTPHeaders{}, azblob.Metadata{},
+		azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return errorResult(err)
+	}
+	j.finish(file.Name())
+
+	return &Result{
+		Response: response.Response(),
+		Error:    nil,
+	}
+}
+
+// stageBlocks uploads blocks which are not staged yet in parallel, all workers share one rate limiter.
+func stageBlocks(ctx context.Context, cfg *config.Upload, blobURL azblob.BlockBlobURL,
+	file *os.File, entry *journalEntry, count int) error {
+	pending := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		if !entry.isStaged(i) {
+			pending = append(pending, i)
+		}
+	}
+
+	stageCtx, cancelFunc := context.WithCancel(ctx)
+	defer cancelFunc()
+
+	limiter := newUploadRateLimiter(cfg)
+	indexes := make(chan int)
+	var once sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+	for w := 0; w < DefaultParallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, entry.BlockSize)
+			for index := range indexes {
+				if err := stageBlock(stageCtx, blobURL, file, entry, index, buf, limiter); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancelFunc()
+					})
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, index := range pending {
+		select {
+		case indexes <- index:
+		case <-stageCtx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func stageBlock(ctx context.Context, blobURL azblob.BlockBlobURL, file *os.File,
+	entry *journalEntry, index int, buf []byte, limiter *rateLimiter) error {
+	offset := int64(index) * entry.BlockSize
+	n, err := io.ReadFull(io.NewSectionReader(file, offset, entry.BlockSize), buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// Body is throttled while it is sent, and again whenever pipeline rewinds it to retry.
+	body := limitReadSeeker(ctx, bytes.NewReader(buf[:n]), limiter)
+	_, err = blobURL.StageBlock(ctx, composeBlockID(index), body,
+		azblob.LeaseAccessConditions{}, nil, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return err
+	}
+	getJournal().staged(entry, index)
+	return nil
+}
+
+// composeBlockID returns base64 block ID, all IDs of a blob must have same length.
+func composeBlockID(index int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("scp-block-%08d", index)))
+}
+
+// PutFilesToAzBlob uploads each files in blocks to a block blob.
+func PutFilesToAzBlob(ctx *context.Context, cfg *config.Upload, filesPath []string) (results []*Result) {
+	for _, f := range filesPath {
+		r := PutFileToAzBlob(ctx, cfg, f)
+		results = append(results, r)
+	}
+
+	return results
+}
+
+// composeRetryOptions returns exponential backoff retry policy of upload setting, zero value means default of azblob.
+func composeRetryOptions(cfg *config.Upload) azblob.RetryOptions {
+	opts := azblob.RetryOptions{
+		Policy:        azblob.RetryPolicyExponential,
+		TryTimeout:    time.Second * time.Duration(cfg.TryTimeoutS),
+		RetryDelay:    time.Second * time.Duration(cfg.RetryDelayS),
+		MaxRetryDelay: time.Second * time.Duration(cfg.MaxRetryDelayS),
+	}
+	if cfg.MaxRetryCount > 0 {
+		// First try is not counted as retry.
+		opts.MaxTries = int32(cfg.MaxRetryCount) + 1
+	}
+
+	// azblob requires both delays are given or neither is given.
+	if opts.RetryDelay > 0 && opts.MaxRetryDelay == 0 {
+		opts.MaxRetryDelay = DefaultMaxRetryDelayS * time.Second
+		if opts.MaxRetryDelay < opts.RetryDelay {
+			opts.MaxRetryDelay = opts.RetryDelay
+		}
+	} else if opts.RetryDelay == 0 && opts.MaxRetryDelay > 0 {
+		opts.RetryDelay = DefaultRetryDelayS * time.Second
+		if opts.RetryDelay > opts.MaxRetryDelay {
+			opts.RetryDelay = opts.MaxRetryDelay
+		}
+	}
+	return opts
+}
+
+func composeAzBlobURL(cfg *config.Upload, filePath string) string {
+	return fmt.Sprintf("https://%s.%s/%s/%s%s",
+		cfg.AzBlob.AccountName, cfg.AzBlob.HostName,
+		cfg.AzBlob.ContainerName, composeObjectPath(cfg, filePath),
+		cfg.AzBlob.SASToken)
+}
@@ -0,0 +1,184 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTestJournal replaces upload journal by one in temporary directory of test.
+func useTestJournal(t *testing.T) *uploadJournal {
+	journalOnce.Do(func() {})
+	journal = &uploadJournal{
+		path:    filepath.Join(t.TempDir(), JournalFileName),
+		Entries: map[string]*journalEntry{},
+	}
+	t.Cleanup(func() {
+		journal = nil
+		journalOnce = sync.Once{}
+	})
+	return journal
+}
+
+// fakeBlobService serves staging blocks, listing uncommitted blocks and committing block list of one blob.
+type fakeBlobService struct {
+	mu          sync.Mutex
+	blocks      map[string][]byte
+	staged      []int
+	failures    int
+	committed   []byte
+	listedBlobs int
+}
+
+func blockIndex(id string) int {
+	b, _ := base64.StdEncoding.DecodeString(id)
+	var index int
+	_, _ = fmt.Sscanf(string(b), "scp-block-%08d", &index)
+	return index
+}
+
+func (s *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut && q.Get("comp") == "block":
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.blocks[q.Get("blockid")] = body
+		s.staged = append(s.staged, blockIndex(q.Get("blockid")))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && q.Get("comp") == "blocklist":
+		s.listedBlobs++
+		list := azblob.BlockList{}
+		for id, b := range s.blocks {
+			list.UncommittedBlocks = append(list.UncommittedBlocks, azblob.Block{Name: id, Size: int64(len(b))})
+		}
+		_ = xml.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPut && q.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.committed = nil
+		for _, id := range list.Latest {
+			s.committed = append(s.committed, s.blocks[id]...)
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newTestBlobURL(t *testing.T, s *fakeBlobService) azblob.BlockBlobURL {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL + "/container/dump.zip?sig=token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{
+		Retry: azblob.RetryOptions{MaxTries: 3, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond},
+	})
+	return azblob.NewBlockBlobURL(*u, pipe)
+}
+
+func TestPutBlockBlobResume(t *testing.T) {
+	useTestLog(t)
+	j := useTestJournal(t)
+	blockSize := int64(DefaultBlockSizeMB << 20)
+	content := make([]byte, 2*blockSize+100)
+	rand.New(rand.NewSource(1)).Read(content)
+	path := writeTempFile(t, "dump.zip", string(content))
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Previous run staged blocks 0 and 1, but service has discarded block 1 since then.
+	s := &fakeBlobService{blocks: map[string][]byte{composeBlockID(0): content[:blockSize]}}
+	blobURL := newTestBlobURL(t, s)
+	noSAS := blobURL.URL()
+	noSAS.RawQuery = ""
+	entry := j.begin(path, noSAS.String(), info, blockSize)
+	j.staged(entry, 0)
+	j.staged(entry, 1)
+
+	r := putBlockBlob(context.Background(), &config.Upload{}, blobURL, file, info)
+	if r.Error != nil {
+		t.Fatalf("putBlockBlob failed with error %s", *r.Error)
+	}
+	sort.Ints(s.staged)
+	if s.listedBlobs != 1 || len(s.staged) != 2 || s.staged[0] != 1 || s.staged[1] != 2 {
+		t.Errorf("blocks %v are staged after listing %d times, want blocks [1 2]", s.staged, s.listedBlobs)
+	}
+	if !bytes.Equal(s.committed, content) {
+		t.Errorf("committed blob has %d bytes, doesn't match file of %d bytes", len(s.committed), len(content))
+	}
+
+	// Journal entry is removed from disk after commit.
+	b, err := ioutil.ReadFile(j.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved uploadJournal
+	if err := json.Unmarshal(b, &saved); err != nil || len(saved.Entries) != 0 || len(j.pending()) != 0 {
+		t.Errorf("journal still has entries %s, error %v", b, err)
+	}
+}
+
+func TestStageBlockThrottlesRetry(t *testing.T) {
+	useTestLog(t)
+	useTestJournal(t)
+	content := make([]byte, minBurstBytes+minBurstBytes/4)
+	file, err := os.Open(writeTempFile(t, "dump.zip", string(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// The first try fails after body is sent, so body is sent twice.
+	s := &fakeBlobService{blocks: map[string][]byte{}, failures: 1}
+	entry := &journalEntry{BlockSize: int64(len(content))}
+	buf := make([]byte, entry.BlockSize)
+	start := time.Now()
+	if err := stageBlock(context.Background(), newTestBlobURL(t, s), file, entry, 0, buf, newRateLimiter(minBurstBytes)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 1400*time.Millisecond {
+		t.Errorf("staging block takes %s, retry isn't throttled", elapsed)
+	}
+	if !bytes.Equal(s.blocks[composeBlockID(0)], content) || !entry.isStaged(0) {
+		t.Error("block isn't staged after retry")
+	}
+}
@@ -0,0 +1,160 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFormField = "file"
+)
+
+type httpUploader struct {
+	cfg *config.Upload
+}
+
+func newHTTPUploader(cfg *config.Upload) Uploader {
+	return &httpUploader{cfg: cfg}
+}
+
+// PutFile sends file to generic HTTP(S) collector by raw body PUT/POST or multipart POST.
+func (u *httpUploader) PutFile(ctx *context.Context, filePath string) *Result {
+	uploadCtx, cancelFunc := context.WithTimeout(*ctx, time.Second*time.Duration(u.cfg.TimeoutS))
+	defer cancelFunc()
+
+	if u.cfg.HTTP.URL == "" {
+		return errorResult(errors.New("HTTP upload URL is empty"))
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errorResult(err)
+	}
+	defer file.Close()
+
+	size, err := getFileSize(filePath)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	method := strings.ToUpper(u.cfg.HTTP.Method)
+	if method == "" {
+		method = http.MethodPut
+	}
+
+	src := newRateLimitedReader(uploadCtx, file, u.cfg)
+	var body io.Reader = src
+	contentType := "application/octet-stream"
+	var pr *io.PipeReader
+	var pw *io.PipeWriter
+	var mw *multipart.Writer
+	if u.cfg.HTTP.Multipart {
+		// Stream multipart body through pipe, so file is never buffered in memory.
+		pr, pw = io.Pipe()
+		mw = multipart.NewWriter(pw)
+		body = pr
+		contentType = mw.FormDataContentType()
+	}
+
+	req, err := http.NewRequest(method, composeHTTPURL(u.cfg, filePath), body)
+	if err != nil {
+		return errorResult(err)
+	}
+	if pr != nil {
+		// Writer starts only after request is created, otherwise it would block on pipe with file open.
+		// Closing the reader stops the writer if request fails, it is waited before file is closed.
+		done := make(chan struct{})
+		go func() {
+			writeMultipart(pw, mw, u.formField(), filePath, src)
+			close(done)
+		}()
+		defer func() {
+			_ = pr.Close()
+			<-done
+		}()
+	}
+	req = req.WithContext(uploadCtx)
+	if !u.cfg.HTTP.Multipart {
+		req.ContentLength = size
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range u.cfg.HTTP.Headers {
+		req.Header.Set(name, value)
+	}
+	if u.cfg.HTTP.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+u.cfg.HTTP.BearerToken)
+	}
+
+	resp, err := newHTTPClient(u.cfg).Do(req)
+	if err != nil {
+		return errorResult(err)
+	}
+	defer resp.Body.Close()
+
+	if !u.isExpectedStatus(resp.StatusCode) {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &Result{
+			Error:    newError(fmt.Sprintf("HTTP upload failed with status %s, %s", resp.Status, msg)),
+			Response: resp,
+		}
+	}
+	return &Result{
+		Response: resp,
+		Error:    nil,
+	}
+}
+
+func (u *httpUploader) formField() string {
+	if u.cfg.HTTP.FormField == "" {
+		return defaultFormField
+	}
+	return u.cfg.HTTP.FormField
+}
+
+// isExpectedStatus accepts any 2xx status if no expected status given.
+func (u *httpUploader) isExpectedStatus(status int) bool {
+	if len(u.cfg.HTTP.ExpectedStatus) == 0 {
+		return status/100 == 2
+	}
+	for _, s := range u.cfg.HTTP.ExpectedStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func writeMultipart(pw *io.PipeWriter, mw *multipart.Writer, field string, filePath string, file io.Reader) {
+	part, err := mw.CreateFormFile(field, filepath.Base(filePath))
+	if err != nil {
+		pw.CloseWithError(err)
+		return
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		pw.CloseWithError(err)
+		return
+	}
+	pw.CloseWithError(mw.Close())
+}
+
+// composeHTTPURL replaces placeholders {seg_case_id}, {company_id}, {device_id} and {file_name} in URL template.
+func composeHTTPURL(cfg *config.Upload, filePath string) string {
+	r := strings.NewReplacer(
+		"{seg_case_id}", url.PathEscape(cfg.SEGCaseID),
+		"{company_id}", url.PathEscape(cfg.CompanyID),
+		"{device_id}", url.PathEscape(cfg.DeviceID),
+		"{file_name}", url.PathEscape(filepath.Base(filePath)),
+	)
+	return r.Replace(cfg.HTTP.URL)
+}
@@ -0,0 +1,176 @@
+package upload
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"scp_delegator/config"
+	"scp_delegator/constant"
+	"scp_delegator/logger"
+	"testing"
+	"time"
+)
+
+// useTestLog writes log into temporary directory of test instead of output directory under the package.
+func useTestLog(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), constant.LogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Wrapper.SetOutput(f)
+	t.Cleanup(func() {
+		logger.Wrapper.SetOutput(ioutil.Discard)
+		_ = f.Close()
+	})
+}
+
+func writeTempFile(t *testing.T, name string, content string) string {
+	p := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newTestHTTPConfig(url string) *config.Upload {
+	return &config.Upload{
+		Backend:   BackendHTTP,
+		TimeoutS:  10,
+		SEGCaseID: "case 1",
+		DeviceID:  "dev1",
+		HTTP:      config.HTTPUpload{URL: url},
+	}
+}
+
+func TestHTTPPutFile(t *testing.T) {
+	useTestLog(t)
+	var method, path, contentType, auth, custom string
+	var body []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type")
+		auth, custom = r.Header.Get("Authorization"), r.Header.Get("X-Custom")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+
+	file := writeTempFile(t, "dump 1.zip", "content of dump")
+	cfg := newTestHTTPConfig(s.URL + "/cases/{seg_case_id}/{device_id}/{file_name}")
+	cfg.HTTP.BearerToken = "token"
+	cfg.HTTP.Headers = map[string]string{"X-Custom": "v"}
+
+	ctx := context.Background()
+	r := newHTTPUploader(cfg).PutFile(&ctx, file)
+	if r.Error != nil {
+		t.Fatalf("PutFile failed with error %s", *r.Error)
+	}
+	if method != http.MethodPut || path != "/cases/case%201/dev1/dump%201.zip" {
+		t.Errorf("request is %s %s", method, path)
+	}
+	if contentType != "application/octet-stream" || auth != "Bearer token" || custom != "v" {
+		t.Errorf("headers are Content-Type=%s, Authorization=%s, X-Custom=%s", contentType, auth, custom)
+	}
+	if string(body) != "content of dump" {
+		t.Errorf("body is %q", body)
+	}
+}
+
+func TestHTTPPutFileMultipart(t *testing.T) {
+	useTestLog(t)
+	var field, name, content string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, h, err := r.FormFile("upload")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		b, _ := ioutil.ReadAll(f)
+		field, name, content = "upload", h.Filename, string(b)
+	}))
+	defer s.Close()
+
+	file := writeTempFile(t, "dump.zip", "multipart content")
+	cfg := newTestHTTPConfig(s.URL + "/upload")
+	cfg.HTTP.Method, cfg.HTTP.Multipart, cfg.HTTP.FormField = "post", true, "upload"
+
+	ctx := context.Background()
+	r := newHTTPUploader(cfg).PutFile(&ctx, file)
+	if r.Error != nil {
+		t.Fatalf("PutFile failed with error %s", *r.Error)
+	}
+	if field != "upload" || name != "dump.zip" || content != "multipart content" {
+		t.Errorf("form file is %s=%s, content %q", field, name, content)
+	}
+}
+
+func TestHTTPPutFileUnexpectedStatus(t *testing.T) {
+	useTestLog(t)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer s.Close()
+
+	file := writeTempFile(t, "dump.zip", "content")
+	cfg := newTestHTTPConfig(s.URL)
+	ctx := context.Background()
+	if r := newHTTPUploader(cfg).PutFile(&ctx, file); r.Error == nil {
+		t.Error("PutFile should fail with status 403")
+	}
+
+	// Status not in expected list is refused even if it is 2xx.
+	cfg.HTTP.ExpectedStatus = []int{201}
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if r := newHTTPUploader(cfg).PutFile(&ctx, file); r.Error == nil {
+		t.Error("PutFile should fail with status 200 when 201 is expected")
+	}
+}
+
+func TestHTTPPutFileFailure(t *testing.T) {
+	useTestLog(t)
+	file := writeTempFile(t, "dump.zip", "content")
+	ctx := context.Background()
+
+	if r := newHTTPUploader(newTestHTTPConfig("")).PutFile(&ctx, file); r.Error == nil {
+		t.Error("PutFile should fail without URL")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + l.Addr().String() + "/upload"
+	_ = l.Close()
+
+	goroutines := runtime.NumGoroutine()
+	for _, multipart := range []bool{false, true} {
+		cfg := newTestHTTPConfig(refused)
+		cfg.HTTP.Multipart = multipart
+		if r := newHTTPUploader(cfg).PutFile(&ctx, file); r.Error == nil {
+			t.Errorf("PutFile with multipart %v should fail when connection is refused", multipart)
+		}
+
+		cfg.HTTP.URL = "http://%zz/upload"
+		if r := newHTTPUploader(cfg).PutFile(&ctx, file); r.Error == nil {
+			t.Errorf("PutFile with multipart %v should fail with invalid URL", multipart)
+		}
+	}
+
+	// Multipart writer must not be left blocked on pipe.
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines are left after failed uploads", n-goroutines)
+	}
+	// File is closed, so it can be removed on every platform.
+	if err := os.Remove(file); err != nil {
+		t.Error(err)
+	}
+}
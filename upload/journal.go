@@ -0,0 +1,155 @@
+package upload
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+	"scp_delegator/logger"
+	"sort"
+	"sync"
+)
+
+const (
+	JournalFileName = "upload_journal.json"
+)
+
+// journalEntry records staged blocks of one uploading file.
+type journalEntry struct {
+	FilePath     string `json:"file_path"`
+	BlobURL      string `json:"blob_url"`
+	Size         int64  `json:"size"`
+	ModTime      int64  `json:"mod_time"`
+	BlockSize    int64  `json:"block_size"`
+	StagedBlocks []int  `json:"staged_blocks"`
+}
+
+func (e *journalEntry) isStaged(index int) bool {
+	for _, i := range e.StagedBlocks {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadJournal persists upload progress in output directory, so uploading can resume after process restarted.
+type uploadJournal struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]*journalEntry `json:"entries"`
+}
+
+var journalOnce sync.Once
+var journal *uploadJournal
+
+// getJournal loads journal from output directory once per process.
+func getJournal() *uploadJournal {
+	journalOnce.Do(func() {
+		journal = &uploadJournal{
+			path:    filepath.Join(config.GetOutputDir(), JournalFileName),
+			Entries: map[string]*journalEntry{},
+		}
+
+		s, err := ioutil.ReadFile(journal.path)
+		if err != nil {
+			return
+		}
+		if err := json.Unmarshal(s, journal); err != nil {
+			logger.Wrapper.LogError("Upload journal %s is broken, error=%s", journal.path, err)
+			journal.Entries = map[string]*journalEntry{}
+		}
+		if journal.Entries == nil {
+			journal.Entries = map[string]*journalEntry{}
+		}
+	})
+	return journal
+}
+
+// begin returns journal entry of file, entry is reset if file or destination changed since last record.
+func (j *uploadJournal) begin(filePath string, blobURL string, info os.FileInfo, blockSize int64) *journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e := j.Entries[filePath]
+	if e != nil && e.BlobURL == blobURL && e.Size == info.Size() &&
+		e.ModTime == info.ModTime().UnixNano() && e.BlockSize == blockSize {
+		return e
+	}
+
+	e = &journalEntry{
+		FilePath:  filePath,
+		BlobURL:   blobURL,
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+		BlockSize: blockSize,
+	}
+	j.Entries[filePath] = e
+	j.saveLocked()
+	return e
+}
+
+// retain keeps staged blocks which still exist in service side.
+func (j *uploadJournal) retain(e *journalEntry, exists func(index int) bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	kept := e.StagedBlocks[:0]
+	for _, i := range e.StagedBlocks {
+		if exists(i) {
+			kept = append(kept, i)
+		}
+	}
+	e.StagedBlocks = kept
+	j.saveLocked()
+}
+
+func (j *uploadJournal) staged(e *journalEntry, index int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e.StagedBlocks = append(e.StagedBlocks, index)
+	sort.Ints(e.StagedBlocks)
+	j.saveLocked()
+}
+
+// finish removes entry of file which is committed.
+func (j *uploadJournal) finish(filePath string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.Entries, filePath)
+	j.saveLocked()
+}
+
+// pending returns files which have not finished uploading.
+func (j *uploadJournal) pending() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	files := make([]string, 0, len(j.Entries))
+	for f := range j.Entries {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (j *uploadJournal) saveLocked() {
+	s, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		logger.Wrapper.LogError("Can't encode upload journal, error=%s", err)
+		return
+	}
+
+	// Write temporary file then rename, so journal is never half written.
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, s, 0644); err != nil {
+		logger.Wrapper.LogError("Can't write upload journal %s, error=%s", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		logger.Wrapper.LogError("Can't replace upload journal %s, error=%s", j.path, err)
+	}
+}
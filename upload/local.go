@@ -0,0 +1,89 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"scp_delegator/config"
+)
+
+type localUploader struct {
+	cfg *config.Upload
+}
+
+func newLocalUploader(cfg *config.Upload) Uploader {
+	return &localUploader{cfg: cfg}
+}
+
+// PutFile copies file into local directory or UNC share, keeps same layout as object path of cloud backends.
+func (u *localUploader) PutFile(ctx *context.Context, filePath string) *Result {
+	if u.cfg.Local.Directory == "" {
+		return errorResult(errors.New("local upload directory is empty"))
+	}
+
+	dst := filepath.Join(u.cfg.Local.Directory, filepath.FromSlash(composeObjectPath(u.cfg, filePath)))
+	if err := os.MkdirAll(filepath.Dir(dst), 0744); err != nil {
+		return errorResult(err)
+	}
+
+	// Copy to temporary file first, so incomplete file never appears at destination.
+	tmp := dst + ".partial"
+	if err := copyFileWithContext(ctx, filePath, tmp); err != nil {
+		os.Remove(tmp)
+		return errorResult(err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return errorResult(err)
+	}
+	return &Result{
+		Response: nil,
+		Error:    nil,
+	}
+}
+
+func copyFileWithContext(ctx *context.Context, src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1<<20)
+	for {
+		select {
+		case <-(*ctx).Done():
+			out.Close()
+			return (*ctx).Err()
+		default:
+		}
+
+		n, readErr := in.Read(buf)
+		if n > 0 {
+			if _, err := out.Write(buf[:n]); err != nil {
+				out.Close()
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			out.Close()
+			return readErr
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return errors.New(fmt.Sprintf("close %s failed with error %s", dst, err))
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLMv2 messages, see MS-NLMP.
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmNegotiateOEM                     = 0x00000002
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmAvIDTimestamp = 7
+	ntlmAvIDEOL       = 0
+
+	// Windows FILETIME counts 100ns intervals since 1601-01-01.
+	filetimeEpochDelta = 116444736000000000
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+const ntlmFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+	ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo |
+	ntlmNegotiate128 | ntlmNegotiate56
+
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmFlags)
+	// Domain and workstation fields are empty.
+	return msg
+}
+
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("invalid NTLM challenge message")
+	}
+
+	c := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, errors.New("invalid target info of NTLM challenge message")
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+	return c, nil
+}
+
+// timestamp returns timestamp given by server in target info, or current time.
+func (c *ntlmChallenge) timestamp() []byte {
+	info := c.targetInfo
+	for len(info) >= 4 {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == ntlmAvIDEOL || 4+length > len(info) {
+			break
+		}
+		if id == ntlmAvIDTimestamp && length == 8 {
+			return info[4:12]
+		}
+		info = info[4+length:]
+	}
+
+	ts := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ts, uint64(time.Now().UnixNano()/100+filetimeEpochDelta))
+	return ts
+}
+
+func ntlmAuthenticateMessage(challengeMsg []byte, domain string, user string, password string) ([]byte, error) {
+	c, err := parseNTLMChallenge(challengeMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow "DOMAIN\user" form in username.
+	if domain == "" {
+		if i := strings.Index(user, "\\"); i >= 0 {
+			domain, user = user[:i], user[i+1:]
+		}
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	workstation, _ := os.Hostname()
+	return ntlmAuthenticate(c, domain, user, password, strings.ToUpper(workstation), clientChallenge, c.timestamp()), nil
+}
+
+// ntlmAuthenticate composes NTLMv2 AUTHENTICATE message without session key.
+func ntlmAuthenticate(c *ntlmChallenge, domain string, user string, password string, workstation string,
+	clientChallenge []byte, timestamp []byte) []byte {
+	ntowf := ntowfv2(domain, user, password)
+
+	var temp bytes.Buffer
+	temp.Write([]byte{1, 1, 0, 0, 0, 0, 0, 0})
+	temp.Write(timestamp)
+	temp.Write(clientChallenge)
+	temp.Write([]byte{0, 0, 0, 0})
+	temp.Write(c.targetInfo)
+	temp.Write([]byte{0, 0, 0, 0})
+
+	ntProof := hmacMD5(ntowf, append(append([]byte{}, c.serverChallenge...), temp.Bytes()...))
+	ntResponse := append(ntProof, temp.Bytes()...)
+	lmResponse := append(hmacMD5(ntowf, append(append([]byte{}, c.serverChallenge...), clientChallenge...)), clientChallenge...)
+
+	payloads := [][]byte{
+		lmResponse,
+		ntResponse,
+		utf16le(domain),
+		utf16le(user),
+		utf16le(workstation),
+		{},
+	}
+
+	const headerSize = 64
+	msg := make([]byte, headerSize)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+
+	offset := headerSize
+	for i, p := range payloads {
+		field := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[field:], uint16(len(p)))
+		binary.LittleEndian.PutUint16(msg[field+2:], uint16(len(p)))
+		binary.LittleEndian.PutUint32(msg[field+4:], uint32(offset))
+		offset += len(p)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], ntlmFlags&c.flags|ntlmNegotiateUnicode)
+	for _, p := range payloads {
+		msg = append(msg, p...)
+	}
+	return msg
+}
+
+// ntowfv2 is NTOWFv2 of MS-NLMP, user name is upper cased but domain isn't.
+func ntowfv2(domain string, user string, password string) []byte {
+	return hmacMD5(md4Sum(utf16le(password)), utf16le(strings.ToUpper(user)+domain))
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, r := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], r)
+	}
+	return b
+}
+
+func hmacMD5(key []byte, data []byte) []byte {
+	h := hmac.New(md5.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// md4Sum implements RFC 1320, MD4 is only needed for NT hash so it is not provided by standard library.
+func md4Sum(data []byte) []byte {
+	a, b, c, d := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+
+	msg := append([]byte{}, data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(data))*8)
+	msg = append(msg, length[:]...)
+
+	f := func(x, y, z uint32) uint32 { return x&y | ^x&z }
+	g := func(x, y, z uint32) uint32 { return x&y | x&z | y&z }
+	h := func(x, y, z uint32) uint32 { return x ^ y ^ z }
+
+	var x [16]uint32
+	for chunk := 0; chunk < len(msg); chunk += 64 {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[chunk+i*4:])
+		}
+		aa, bb, cc, dd := a, b, c, d
+
+		for _, i := range []uint{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+f(b, c, d)+x[i], 3)
+			d = bits.RotateLeft32(d+f(a, b, c)+x[i+1], 7)
+			c = bits.RotateLeft32(c+f(d, a, b)+x[i+2], 11)
+			b = bits.RotateLeft32(b+f(c, d, a)+x[i+3], 19)
+		}
+		for _, i := range []uint{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+g(b, c, d)+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+g(a, b, c)+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+g(d, a, b)+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+g(c, d, a)+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range []uint{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+h(b, c, d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+h(a, b, c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+h(d, a, b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+h(c, d, a)+x[i+12]+0x6ed9eba1, 15)
+		}
+
+		a += aa
+		b += bb
+		c += cc
+		d += dd
+	}
+
+	sum := make([]byte, 16)
+	binary.LittleEndian.PutUint32(sum[0:], a)
+	binary.LittleEndian.PutUint32(sum[4:], b)
+	binary.LittleEndian.PutUint32(sum[8:], c)
+	binary.LittleEndian.PutUint32(sum[12:], d)
+	return sum
+}
@@ -0,0 +1,125 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Test suite of RFC 1320 appendix A.5.
+func TestMD4Sum(t *testing.T) {
+	cases := []struct {
+		data string
+		want string
+	}{
+		{"", "31d6cfe0d16ae931b73c59d7e0c089c0"},
+		{"a", "bde52cb31de33e46245e05fbdbd6fb24"},
+		{"abc", "a448017aaf21d8525fc10ae87aa6729d"},
+		{"message digest", "d9130a8164549fe818874806e1c7014b"},
+		{"abcdefghijklmnopqrstuvwxyz", "d79e1c308aa5bbcdeea8ed63df412da9"},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", "043f8582f241db351ce627e153e7f0e4"},
+		{"12345678901234567890123456789012345678901234567890123456789012345678901234567890", "e33b4ddc9c38f2199c3e7b164fcc0536"},
+	}
+	for _, c := range cases {
+		if got := hex.EncodeToString(md4Sum([]byte(c.data))); got != c.want {
+			t.Errorf("md4Sum(%q) = %s, want %s", c.data, got, c.want)
+		}
+	}
+}
+
+// Values of MS-NLMP 4.2.4 NTLMv2 authentication example.
+const (
+	ntlmTestUser            = "User"
+	ntlmTestDomain          = "Domain"
+	ntlmTestPassword        = "Password"
+	ntlmTestWorkstation     = "COMPUTER"
+	ntlmTestClientChallenge = "aaaaaaaaaaaaaaaa"
+	ntlmTestTime            = "0000000000000000"
+	// CHALLENGE_MESSAGE of 4.2.4.3, target name "Domain" and target info with NetBIOS domain and computer names.
+	ntlmTestChallenge = "4e544c4d53535000020000000c000c003800000033828ae20123456789abcdef" +
+		"00000000000000002400240044000000060070170000000f44006f006d00610069006e00" +
+		"02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000"
+)
+
+func TestNTLMv2(t *testing.T) {
+	if got, want := hex.EncodeToString(md4Sum(utf16le(ntlmTestPassword))), "a4f49c406510bdcab6824ee7c30fd852"; got != want {
+		t.Errorf("NT hash = %s, want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(ntowfv2(ntlmTestDomain, ntlmTestUser, ntlmTestPassword)), "0c868a403bfd7a93a3001ef22ef02e3f"; got != want {
+		t.Errorf("NTOWFv2 = %s, want %s", got, want)
+	}
+
+	c, err := parseNTLMChallenge(unhex(t, ntlmTestChallenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(c.serverChallenge) != "0123456789abcdef" || c.flags != 0xe28a8233 || len(c.targetInfo) != 36 {
+		t.Fatalf("challenge is parsed as %+v", c)
+	}
+
+	msg := ntlmAuthenticate(c, ntlmTestDomain, ntlmTestUser, ntlmTestPassword, ntlmTestWorkstation,
+		unhex(t, ntlmTestClientChallenge), unhex(t, ntlmTestTime))
+	if !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 3 {
+		t.Fatalf("message isn't AUTHENTICATE_MESSAGE, header %x", msg[:12])
+	}
+	if flags := binary.LittleEndian.Uint32(msg[60:]); flags != ntlmFlags&0xe28a8233 {
+		t.Errorf("negotiate flags = %08x, want %08x", flags, ntlmFlags&0xe28a8233)
+	}
+
+	// Fields in order of LmChallengeResponse, NtChallengeResponse, DomainName, UserName, Workstation, EncryptedRandomSessionKey.
+	ntProofStr := "68cd0ab851e51c96aabc927bebef6a1c"
+	fields := []struct {
+		name string
+		want []byte
+	}{
+		{"LMv2 response", unhex(t, "86c35097ac9cec102554764a57cccc19"+ntlmTestClientChallenge)},
+		{"NTLMv2 response", unhex(t, ntProofStr+"0101000000000000"+ntlmTestTime+ntlmTestClientChallenge+"00000000"+
+			hex.EncodeToString(c.targetInfo)+"00000000")},
+		{"domain", utf16le(ntlmTestDomain)},
+		{"user", utf16le(ntlmTestUser)},
+		{"workstation", utf16le(ntlmTestWorkstation)},
+		{"session key", []byte{}},
+	}
+	end := 64
+	for i, f := range fields {
+		length := int(binary.LittleEndian.Uint16(msg[12+i*8:]))
+		offset := int(binary.LittleEndian.Uint32(msg[12+i*8+4:]))
+		if offset != end || offset+length > len(msg) {
+			t.Fatalf("%s is at offset %d length %d of %d bytes message, want offset %d", f.name, offset, length, len(msg), end)
+		}
+		if got := msg[offset : offset+length]; !bytes.Equal(got, f.want) {
+			t.Errorf("%s = %x, want %x", f.name, got, f.want)
+		}
+		end = offset + length
+	}
+	if end != len(msg) {
+		t.Errorf("message has %d bytes after payload", len(msg)-end)
+	}
+}
+
+func TestNTLMAuthenticateMessageDomainUser(t *testing.T) {
+	msg, err := ntlmAuthenticateMessage(unhex(t, ntlmTestChallenge), "", ntlmTestDomain+`\`+ntlmTestUser, ntlmTestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range map[int]string{2: ntlmTestDomain, 3: ntlmTestUser} {
+		length := int(binary.LittleEndian.Uint16(msg[12+i*8:]))
+		offset := int(binary.LittleEndian.Uint32(msg[12+i*8+4:]))
+		if got := msg[offset : offset+length]; !bytes.Equal(got, utf16le(want)) {
+			t.Errorf("field %d = %x, want %s", i, got, want)
+		}
+	}
+
+	if _, err := ntlmAuthenticateMessage([]byte("NTLMSSP\x00\x01\x00\x00\x00"), "", ntlmTestUser, ntlmTestPassword); err == nil {
+		t.Error("NEGOTIATE_MESSAGE is accepted as challenge")
+	}
+}
@@ -1 +1,291 @@
 package upload
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"scp_delegator/config"
+	"scp_delegator/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProxyAuthNone  = ""
+	ProxyAuthBasic = "basic"
+	ProxyAuthNTLM  = "ntlm"
+)
+
+const (
+	proxyProbeTimeout  = 5 * time.Second
+	proxyProbeInterval = 60 * time.Second
+	dialTimeout        = 30 * time.Second
+)
+
+// proxySetting decides proxy of each request by upload setting, it never touches process environment.
+type proxySetting struct {
+	cfg     *config.Proxy
+	address string
+
+	mu        sync.Mutex
+	lastProbe time.Time
+	reachable bool
+}
+
+func newProxySetting(cfg *config.Proxy) *proxySetting {
+	if cfg.Host == "" || cfg.Port == 0 {
+		return nil
+	}
+	return &proxySetting{
+		cfg:     cfg,
+		address: net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))),
+	}
+}
+
+// newHTTPClient returns client of which transport applies proxy setting of upload setting.
+func newHTTPClient(cfg *config.Upload) *http.Client {
+	return &http.Client{Transport: newTransport(cfg)}
+}
+
+func newTransport(cfg *config.Upload) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+
+	p := newProxySetting(&cfg.Proxy)
+	if p == nil {
+		// No proxy configured, keep proxy of environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY) as default transport.
+		return t
+	}
+
+	if strings.EqualFold(cfg.Proxy.Auth, ProxyAuthNTLM) {
+		// NTLM authenticates the connection, so tunnel is established by dialer instead of transport.
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if !p.useProxy(addr) {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			return p.dialNTLMTunnel(ctx, dialer, addr)
+		}
+		return t
+	}
+
+	t.Proxy = p.proxyURL
+	return t
+}
+
+// newPipelineSender returns azblob HTTP sender which sends requests by client with proxy setting.
+func newPipelineSender(cfg *config.Upload) pipeline.Factory {
+	client := newHTTPClient(cfg)
+	return pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+		return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+			r, err := client.Do(request.WithContext(ctx))
+			if err != nil {
+				err = pipeline.NewError(err, "HTTP request failed")
+			}
+			return pipeline.NewHTTPResponse(r), err
+		}
+	})
+}
+
+// proxyURL is Proxy function of transport, returns nil URL for direct connection.
+func (p *proxySetting) proxyURL(req *http.Request) (*url.URL, error) {
+	if !p.useProxy(req.URL.Host) {
+		return nil, nil
+	}
+
+	scheme := p.cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	u := &url.URL{Scheme: scheme, Host: p.address}
+	if strings.EqualFold(p.cfg.Auth, ProxyAuthBasic) || (p.cfg.Auth == ProxyAuthNone && p.cfg.Username != "") {
+		// Transport sends Proxy-Authorization header for both plain request and CONNECT.
+		u.User = url.UserPassword(p.cfg.Username, p.cfg.Password)
+	}
+	return u, nil
+}
+
+// useProxy reports whether request to addr should go through proxy.
+func (p *proxySetting) useProxy(addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	if matchNoProxy(p.cfg.NoProxy, addr) {
+		return false
+	}
+
+	if p.cfg.DisableDirectFallback {
+		return true
+	}
+	if !p.isReachable() {
+		logger.Wrapper.LogInfo("Proxy %s is unreachable, fallback to direct connection to %s", p.address, host)
+		return false
+	}
+	return true
+}
+
+// isReachable probes proxy by TCP connection, result is cached for a while.
+func (p *proxySetting) isReachable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.lastProbe.IsZero() && time.Since(p.lastProbe) < proxyProbeInterval {
+		return p.reachable
+	}
+
+	conn, err := net.DialTimeout("tcp", p.address, proxyProbeTimeout)
+	p.lastProbe = time.Now()
+	p.reachable = err == nil
+	if err == nil {
+		conn.Close()
+	}
+	return p.reachable
+}
+
+// matchNoProxy supports "*", exact host, domain suffix (".example.com" or "*.example.com") and CIDR,
+// entry with port like "example.com:8080" only matches that port. addr is host with optional port.
+func matchNoProxy(noProxy []string, addr string) bool {
+	host, port := addr, ""
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		entry = strings.Trim(entry, "[]")
+		if entry == host {
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		suffix := strings.TrimPrefix(entry, "*")
+		if !strings.HasPrefix(suffix, ".") {
+			suffix = "." + suffix
+		}
+		if strings.HasSuffix(host, suffix) || host == strings.TrimPrefix(suffix, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// dialNTLMTunnel establishes CONNECT tunnel to addr through proxy with NTLM handshake on same connection.
+func (p *proxySetting) dialNTLMTunnel(ctx context.Context, dialer *net.Dialer, addr string) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := sendConnect(conn, reader, addr, "NTLM "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		// Proxy doesn't require authentication.
+		return conn, nil
+	}
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		conn.Close()
+		return nil, errors.New(fmt.Sprintf("proxy CONNECT failed with status %s", resp.Status))
+	}
+
+	challenge, err := parseNTLMChallengeHeader(resp.Header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	auth, err := ntlmAuthenticateMessage(challenge, p.cfg.Domain, p.cfg.Username, p.cfg.Password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err = sendConnect(conn, reader, addr, "NTLM "+base64.StdEncoding.EncodeToString(auth))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.New(fmt.Sprintf("proxy NTLM authentication failed with status %s", resp.Status))
+	}
+	return conn, nil
+}
+
+func sendConnect(conn net.Conn, reader *bufio.Reader, addr string, authorization string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{
+			"Proxy-Authorization": {authorization},
+			"Proxy-Connection":    {"Keep-Alive"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Drain body so connection can be reused for next step of handshake.
+		// Body of successful CONNECT is the tunnel itself, so it must not be read.
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+func parseNTLMChallengeHeader(header http.Header) ([]byte, error) {
+	for _, v := range header.Values("Proxy-Authenticate") {
+		if strings.HasPrefix(v, "NTLM ") {
+			return base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(v, "NTLM ")))
+		}
+	}
+	return nil, errors.New("proxy doesn't respond NTLM challenge")
+}
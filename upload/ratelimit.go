@@ -0,0 +1,128 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"math"
+	"scp_delegator/config"
+	"sync"
+	"time"
+)
+
+const (
+	minBurstBytes = 32 << 10
+)
+
+// rateLimiter is a token bucket refilled at rate bytes per second, burst is capacity of bucket.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	burst := math.Max(float64(bytesPerSec), minBurstBytes)
+	return &rateLimiter{
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n bytes are allowed to transfer or context done, n must not exceed burst.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= float64(n) {
+			l.tokens -= float64(n)
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((float64(n) - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// rateLimitedReader throttles underlying reader by token bucket.
+type rateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+// rateLimitedReadSeeker throttles a rewindable request body, every pass of reading is throttled.
+type rateLimitedReadSeeker struct {
+	rateLimitedReader
+	seeker io.Seeker
+}
+
+// newUploadRateLimiter returns limiter of upload setting, returns nil if no limit given.
+func newUploadRateLimiter(cfg *config.Upload) *rateLimiter {
+	if cfg.RateLimitMB == 0 {
+		return nil
+	}
+	return newRateLimiter(int64(cfg.RateLimitMB) << 20)
+}
+
+// newRateLimitedReader wraps reader by rate limit of upload setting, returns reader itself if no limit given.
+func newRateLimitedReader(ctx context.Context, r io.Reader, cfg *config.Upload) io.Reader {
+	return limitReader(ctx, r, newUploadRateLimiter(cfg))
+}
+
+// limitReader wraps reader by given limiter which may be shared by several readers.
+func limitReader(ctx context.Context, r io.Reader, limiter *rateLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{
+		ctx:     ctx,
+		reader:  r,
+		limiter: limiter,
+	}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > int(r.limiter.burst) {
+		p = p[:int(r.limiter.burst)]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// limitReadSeeker wraps rewindable body by given limiter, so retries which read body again are throttled too.
+func limitReadSeeker(ctx context.Context, r io.ReadSeeker, limiter *rateLimiter) io.ReadSeeker {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReadSeeker{
+		rateLimitedReader: rateLimitedReader{
+			ctx:     ctx,
+			reader:  r,
+			limiter: limiter,
+		},
+		seeker: r,
+	}
+}
+
+func (r *rateLimitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.seeker.Seek(offset, whence)
+}
@@ -0,0 +1,59 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(minBurstBytes)
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := l.wait(ctx, minBurstBytes); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("waiting for burst takes %s", elapsed)
+	}
+	if err := l.wait(ctx, minBurstBytes/2); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > time.Second {
+		t.Errorf("waiting for half of rate after burst takes %s, want 500ms", elapsed)
+	}
+
+	cancelled, cancelFunc := context.WithCancel(ctx)
+	cancelFunc()
+	if err := l.wait(cancelled, minBurstBytes); err != context.Canceled {
+		t.Errorf("waiting with cancelled context returns error %v", err)
+	}
+}
+
+func TestLimitReadSeeker(t *testing.T) {
+	if r := bytes.NewReader(nil); limitReadSeeker(context.Background(), r, nil) != io.ReadSeeker(r) {
+		t.Error("body isn't returned as is without limiter")
+	}
+
+	content := make([]byte, minBurstBytes+minBurstBytes/4)
+	body := limitReadSeeker(context.Background(), bytes.NewReader(content), newRateLimiter(minBurstBytes))
+
+	// The first pass exceeds burst by a quarter, rewound pass is throttled as a whole.
+	start := time.Now()
+	for pass, want := range []time.Duration{250 * time.Millisecond, 1500 * time.Millisecond} {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil || len(b) != len(content) {
+			t.Fatalf("pass %d reads %d bytes, error %v", pass, len(b), err)
+		}
+		if elapsed := time.Since(start); elapsed < want-100*time.Millisecond {
+			t.Errorf("pass %d ends after %s, want %s", pass, elapsed, want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package upload
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"scp_delegator/config"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service       = "s3"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3DefaultRegion = "us-east-1"
+	amzDateFormat   = "20060102T150405Z"
+	amzDayFormat    = "20060102"
+)
+
+type s3Uploader struct {
+	cfg *config.Upload
+}
+
+func newS3Uploader(cfg *config.Upload) Uploader {
+	return &s3Uploader{cfg: cfg}
+}
+
+// PutFile uploads file to S3 compatible storage by single PUT object request signed with AWS signature V4.
+func (u *s3Uploader) PutFile(ctx *context.Context, filePath string) *Result {
+	uploadCtx, cancelFunc := context.WithTimeout(*ctx, time.Second*time.Duration(u.cfg.TimeoutS))
+	defer cancelFunc()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errorResult(err)
+	}
+	defer file.Close()
+
+	// Payload hash is part of signature, so file is read twice.
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return errorResult(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return errorResult(err)
+	}
+	payloadHash := hex.EncodeToString(hash.Sum(nil))
+
+	objectURL, err := composeS3URL(u.cfg, filePath)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, objectURL.String(), newRateLimitedReader(uploadCtx, file, u.cfg))
+	if err != nil {
+		return errorResult(err)
+	}
+	req = req.WithContext(uploadCtx)
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	signS3Request(req, &u.cfg.S3, payloadHash, time.Now().UTC())
+
+	resp, err := newHTTPClient(u.cfg).Do(req)
+	if err != nil {
+		return errorResult(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &Result{
+			Error:    newError(fmt.Sprintf("S3 put object failed with status %s, %s", resp.Status, body)),
+			Response: resp,
+		}
+	}
+	return &Result{
+		Response: resp,
+		Error:    nil,
+	}
+}
+
+func newError(s string) *error {
+	err := errors.New(s)
+	return &err
+}
+
+// composeS3URL returns object URL in path style (endpoint/bucket/key) or virtual hosted style (bucket.endpoint/key).
+func composeS3URL(cfg *config.Upload, filePath string) (*url.URL, error) {
+	endpoint := cfg.S3.Endpoint
+	if endpoint == "" {
+		region := cfg.S3.Region
+		if region == "" {
+			region = s3DefaultRegion
+		}
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	} else if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	key := composeObjectPath(cfg, filePath)
+	if cfg.S3.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + cfg.S3.Bucket + "/" + key
+	} else {
+		u.Host = cfg.S3.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return u, nil
+}
+
+// s3EscapePath encodes each path segment as RFC 3986 required by signature V4.
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signS3Request adds AWS signature V4 authorization header to request.
+func signS3Request(req *http.Request, cfg *config.S3, payloadHash string, now time.Time) {
+	region := cfg.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	amzDate := now.Format(amzDateFormat)
+	day := now.Format(amzDayFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.SessionToken)
+	}
+
+	// Canonical headers must be sorted by lower case name.
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", day, region, s3Service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+cfg.SecretAccessKey), day)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, cfg.AccessKeyID, scope, signedHeaders, signature))
+}
@@ -2,15 +2,20 @@ package upload
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/Azure/azure-storage-blob-go/azblob"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"scp_delegator/config"
 	"scp_delegator/logger"
-	"time"
+)
+
+const (
+	BackendAzBlob = "azure_blob"
+	BackendS3     = "s3"
+	BackendLocal  = "local"
+	BackendHTTP   = "http"
 )
 
 type Result struct {
@@ -18,95 +23,106 @@ type Result struct {
 	Response *http.Response
 }
 
-// PutFileToAzBlob will upload file to Azure blob
-func PutFileToAzBlob(ctx *context.Context, cfg *config.Upload, filePath string) *Result {
-	uploadCtx, cancelFunc := context.WithTimeout(*ctx, time.Second*time.Duration(cfg.TimeoutS))
-	defer cancelFunc()
+// Uploader is common interface of upload backends.
+type Uploader interface {
+	PutFile(ctx *context.Context, filePath string) *Result
+}
 
-	// Open file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return &Result{
-			Error:    &err,
-			Response: nil,
-		}
-	}
-	defer file.Close()
-
-	// Set proxy to env
-	setProxy(cfg)
-
-	// Prepare upload URL, pipeline, and options
-	/*
-		retryOpts := azblob.RetryOptions{
-			Policy:                      azblob.RetryPolicyFixed,
-			MaxTries:                    int32(cfg.MaxRetryCount),
-			//TryTimeout:                  time.Duration(cfg.TimeoutS),
-			RetryDelay:                  0,
-			MaxRetryDelay:               0,
-			RetryReadsFromSecondaryHost: "",
-		}
-	*/
+// =================================================
+// Add factory at below if add new upload backend
+// =================================================
+type UploaderFactory func(cfg *config.Upload) Uploader
 
-	pipe := azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{})
-	url, err := url.Parse(composeAzBlobURL(cfg, filePath))
-	if err != nil {
-		return &Result{
-			Error:    &err,
-			Response: nil,
-		}
-	}
+var UploaderMap = map[string]UploaderFactory{
+	BackendAzBlob: newAzBlobUploader,
+	BackendS3:     newS3Uploader,
+	BackendLocal:  newLocalUploader,
+	BackendHTTP:   newHTTPUploader,
+}
 
-	blobURL := azblob.NewBlockBlobURL(*url, pipe)
-	blobOptions := azblob.UploadToBlockBlobOptions{
-		BlockSize:   int64(cfg.MaxBlockSizeMB << 10),
-		Parallelism: 16,
-	}
+// =================================================
 
-	response, err := azblob.UploadFileToBlockBlob(uploadCtx, file, blobURL, blobOptions)
-	if err != nil {
-		return &Result{
-			Error:    &err,
-			Response: nil,
-		}
+// NewUploader creates uploader of backend given in upload setting, Azure Blob is default backend.
+func NewUploader(cfg *config.Upload) (Uploader, error) {
+	backend := cfg.Backend
+	if backend == "" {
+		backend = BackendAzBlob
 	}
 
-	return &Result{
-		Response: response.Response(),
-		Error:    nil,
+	factory := UploaderMap[backend]
+	if factory == nil {
+		return nil, errors.New(fmt.Sprintf("unsupported upload backend %s", backend))
 	}
+	return factory(cfg), nil
 }
 
-// PutFiles uploads each files in blocks to a block blob.
-func PutFilesToAzBlob(ctx *context.Context, cfg *config.Upload, filesPath []string) (results []*Result) {
+// PutFiles uploads each files to backend given in upload setting.
+func PutFiles(ctx *context.Context, cfg *config.Upload, filesPath []string) (results []*Result) {
+	uploader, err := NewUploader(cfg)
+	if err != nil {
+		return append(results, errorResult(err))
+	}
+
 	for _, f := range filesPath {
-		r := PutFileToAzBlob(ctx, cfg, f)
+		r := uploader.PutFile(ctx, f)
+		if r.Error == nil {
+			logger.Wrapper.LogInfo("Uploaded %s to %s", f, cfg.Backend)
+		}
 		results = append(results, r)
 	}
-
 	return results
 }
 
-func setProxy(cfg *config.Upload) {
-	if cfg.Proxy.Host != "" && cfg.Proxy.Port != 0 {
-		s := fmt.Sprintf("http://%s:%d", cfg.Proxy.Host, cfg.Proxy.Port)
-		if err := os.Setenv("HTTP_PROXY", s); err != nil {
-			logger.Wrapper.LogError("Error when set environment http_proxy")
+// ResumePending uploads files which left unfinished in upload journal by previous run with backend given
+// in upload setting. Only Azure Blob resumes from staged blocks, other backends upload whole files again.
+func ResumePending(ctx *context.Context, cfg *config.Upload) (results []*Result) {
+	j := getJournal()
+	files := j.pending()
+	if len(files) == 0 {
+		return results
+	}
+	uploader, err := NewUploader(cfg)
+	if err != nil {
+		return append(results, errorResult(err))
+	}
+
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			logger.Wrapper.LogInfo("Drop journal of %s because file is gone, error=%s", f, err)
+			j.finish(f)
+			continue
 		}
-		s = fmt.Sprintf("https://%s:%d", cfg.Proxy.Host, cfg.Proxy.Port)
-		if err := os.Setenv("HTTPS_PROXY", s); err != nil {
-			logger.Wrapper.LogError("Error when set environment https_proxy")
+
+		logger.Wrapper.LogInfo("Resume unfinished upload of %s", f)
+		r := uploader.PutFile(ctx, f)
+		if r.Error == nil {
+			// Azure Blob uploader finishes its journal entry itself, others never write one.
+			j.finish(f)
 		}
+		results = append(results, r)
 	}
+	return results
 }
 
-func composeAzBlobURL(cfg *config.Upload, filePath string) string {
+func errorResult(err error) *Result {
+	return &Result{
+		Error:    &err,
+		Response: nil,
+	}
+}
+
+// composeObjectPath returns relative path of uploaded file which is shared by all backends.
+func composeObjectPath(cfg *config.Upload, filePath string) string {
 	fileName := filepath.Base(filePath)
-	return fmt.Sprintf("https://%s.%s/%s/%s/%s/%s/%s%s",
-		cfg.AzBlob.AccountName, cfg.AzBlob.HostName,
-		cfg.AzBlob.ContainerName, cfg.SEGCaseID,
-		cfg.CompanyID, cfg.DeviceID, fileName,
-		cfg.AzBlob.SASToken)
+	return fmt.Sprintf("%s/%s/%s/%s", cfg.SEGCaseID, cfg.CompanyID, cfg.DeviceID, fileName)
+}
+
+func getFileSize(filePath string) (int64, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
 }
 
 func progressUpdate(byteTransferred int64) {
@@ -1 +1,358 @@
 package validation
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"scp_delegator/config"
+	"scp_delegator/constant"
+	"scp_delegator/crypto"
+	"scp_delegator/task"
+	"scp_delegator/upload"
+	"scp_delegator/zip"
+	"strings"
+)
+
+// Error is a single validation failure located by JSON path of profile.
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Errors collects all validation failures of a profile.
+type Errors []*Error
+
+func (es Errors) Error() string {
+	s := make([]string, len(es))
+	for i, e := range es {
+		s[i] = e.Error()
+	}
+	return fmt.Sprintf("profile validation failed with %d errors: %s", len(es), strings.Join(s, "; "))
+}
+
+type validator struct {
+	cfg    *config.Config
+	errors Errors
+
+	tasks      map[uint32]bool
+	actions    map[uint32]bool
+	properties map[uint32]bool
+	conditions map[uint32]bool
+	criteria   map[uint32]bool
+}
+
+// Validate checks references, IDs, criteria types, operators, executables, bundles and upload setting of given config.
+// It returns nil if config is valid, otherwise returns Errors.
+func Validate(cfg *config.Config) error {
+	errs := Check(cfg)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Check returns all validation errors of given config.
+func Check(cfg *config.Config) Errors {
+	v := &validator{cfg: cfg}
+	v.collectIDs()
+	v.checkTasks()
+	v.checkActions()
+	v.checkConditions()
+	v.checkConditionCriteria()
+	v.checkBundles()
+	v.checkUpload()
+	v.checkProxy()
+	return v.errors
+}
+
+func (v *validator) addError(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) collectIDs() {
+	collect := func(path string, ids []uint32) map[uint32]bool {
+		m := make(map[uint32]bool, len(ids))
+		for i, id := range ids {
+			if m[id] {
+				v.addError(fmt.Sprintf("%s[%d].id", path, i), "duplicate ID %d", id)
+			}
+			m[id] = true
+		}
+		return m
+	}
+
+	t := v.cfg.Template
+	ids := make([]uint32, 0, len(v.cfg.Tasks))
+	for _, x := range v.cfg.Tasks {
+		ids = append(ids, x.ID)
+	}
+	v.tasks = collect("$.tasks", ids)
+
+	ids = make([]uint32, 0, len(t.Actions))
+	for _, x := range t.Actions {
+		ids = append(ids, x.ID)
+	}
+	v.actions = collect("$.template.actions", ids)
+
+	ids = make([]uint32, 0, len(t.ActionsProperties))
+	for _, x := range t.ActionsProperties {
+		ids = append(ids, x.ID)
+	}
+	v.properties = collect("$.template.action_properties", ids)
+
+	ids = make([]uint32, 0, len(t.Conditions))
+	for _, x := range t.Conditions {
+		ids = append(ids, x.ID)
+	}
+	v.conditions = collect("$.template.conditions", ids)
+
+	ids = make([]uint32, 0, len(t.ConditionCriteria))
+	for _, x := range t.ConditionCriteria {
+		ids = append(ids, x.ID)
+	}
+	v.criteria = collect("$.template.condition_criteria", ids)
+}
+
+func (v *validator) checkTasks() {
+	for i, t := range v.cfg.Tasks {
+		path := fmt.Sprintf("$.tasks[%d]", i)
+		// Condition ID 0 represents execute action immediately.
+		if t.ConditionID != 0 && !v.conditions[t.ConditionID] {
+			v.addError(path+".condition", "condition ID %d not found in template", t.ConditionID)
+		}
+		if !v.actions[t.ActionID] {
+			v.addError(path+".action", "action ID %d not found in template", t.ActionID)
+		}
+	}
+}
+
+func (v *validator) checkActions() {
+	for i, a := range v.cfg.Template.Actions {
+		path := fmt.Sprintf("$.template.actions[%d]", i)
+		if a.PreAction != 0 && !v.actions[a.PreAction] {
+			v.addError(path+".pre_action", "action ID %d not found in template", a.PreAction)
+		}
+		if a.PostAction != 0 && !v.actions[a.PostAction] {
+			v.addError(path+".post_action", "action ID %d not found in template", a.PostAction)
+		}
+		if !v.properties[a.Property] {
+			v.addError(path+".property", "action property ID %d not found in template", a.Property)
+		}
+		if a.OutputRotation > 0 && a.MaxOutputMB == 0 {
+			v.addError(path+".output_rotation", "rotation requires max_output_MB")
+		}
+		if !task.IsValidActionKind(a.Kind) {
+			v.addError(path+".kind", "unknown action kind %s", a.Kind)
+			continue
+		}
+		if a.RequiredOutput != "" {
+			if _, err := regexp.Compile(a.RequiredOutput); err != nil {
+				v.addError(path+".required_output", "invalid pattern, %s", err.Error())
+			}
+		}
+		if a.ForbiddenOutput != "" {
+			if _, err := regexp.Compile(a.ForbiddenOutput); err != nil {
+				v.addError(path+".forbidden_output", "invalid pattern, %s", err.Error())
+			}
+		}
+		if _, ok := task.NativeActionMap[a.Kind]; ok {
+			if a.RequiredOutput != "" || a.ForbiddenOutput != "" {
+				v.addError(path+".kind", "output patterns are not supported by native action %s", a.Kind)
+			}
+			if task.PathActions[a.Kind] && len(a.Paths) == 0 {
+				v.addError(path+".paths", "no path given")
+			}
+			if !task.IsValidNativeOutput(a.Output) {
+				v.addError(path+".output", "output %s of native action must be a file name", a.Output)
+			}
+			continue
+		}
+		if a.Executable == "" {
+			v.addError(path+".executable", "executable is empty")
+			continue
+		}
+		switch a.Kind {
+		case "", task.ActionKindEmbedded:
+			if _, ok := constant.EmbedBinaryOptions[a.Executable]; !ok {
+				v.addError(path+".executable", "unknown executable %s", a.Executable)
+			}
+		case task.ActionKindExec:
+			// Executable in PATH or relative to working directory is resolved on target machine,
+			// only the allow-list can be checked here.
+			if !task.IsListedExecutable(a.Executable) {
+				v.addError(path+".executable", "executable %s is not allowed", a.Executable)
+			}
+		}
+	}
+}
+
+func (v *validator) checkConditions() {
+	for i, c := range v.cfg.Template.Conditions {
+		if !task.IsValidAggregation(c.Aggregation) {
+			v.addError(fmt.Sprintf("$.template.conditions[%d].aggregation", i), "unknown aggregation %s", c.Aggregation)
+		}
+		if c.TargetCmdline != "" {
+			if _, err := regexp.Compile(c.TargetCmdline); err != nil {
+				v.addError(fmt.Sprintf("$.template.conditions[%d].monitor_cmdline", i), "invalid pattern, %s", err.Error())
+			}
+		}
+		if c.Expression != "" {
+			if _, err := task.ParseExpression(c.Expression); err != nil {
+				v.addError(fmt.Sprintf("$.template.conditions[%d].expression", i), "invalid expression, %s", err.Error())
+			}
+		}
+		// Zero timeout expires the condition before it is checked once.
+		if c.TimeoutS == 0 {
+			v.addError(fmt.Sprintf("$.template.conditions[%d].timeout_sec", i), "timeout must be positive")
+		}
+		path := fmt.Sprintf("$.template.conditions[%d].criteria", i)
+		for j, id := range c.Criteria.Mandatory {
+			if !v.criteria[id] {
+				v.addError(fmt.Sprintf("%s.mandatory[%d]", path, j), "condition criteria ID %d not found in template", id)
+			}
+		}
+		for j, id := range c.Criteria.Optional {
+			if !v.criteria[id] {
+				v.addError(fmt.Sprintf("%s.optional[%d]", path, j), "condition criteria ID %d not found in template", id)
+			}
+		}
+	}
+}
+
+func (v *validator) checkConditionCriteria() {
+	for i, c := range v.cfg.Template.ConditionCriteria {
+		path := fmt.Sprintf("$.template.condition_criteria[%d]", i)
+		if _, ok := task.ConditionCheckerMap[c.Type]; !ok {
+			v.addError(path+".type", "unknown criteria type %s", c.Type)
+		}
+		if !task.IsValidOperator(c.Operator) {
+			v.addError(path+".operator", "invalid operator %s", c.Operator)
+		}
+		if !task.IsValidThresholdUnit(c.Type, c.Threshold.Unit) {
+			v.addError(path+".threshold", "unit %s is not supported by criteria type %s", c.Threshold.Unit, c.Type)
+		}
+		if task.PathCriteria[c.Type] && len(c.Paths) == 0 {
+			v.addError(path+".paths", "no path given")
+		}
+		if task.NetworkCriteria[c.Type] {
+			v.checkTarget(path+".target", c)
+		}
+		if c.Type == "LogPattern" {
+			if _, err := regexp.Compile(c.Pattern); err != nil {
+				v.addError(path+".pattern", "invalid pattern, %s", err.Error())
+			}
+		}
+		if !task.IsValidWindowFunction(c.Function) {
+			v.addError(path+".function", "unknown window function %s", c.Function)
+		} else if c.Function != "" && (c.WindowS == 0 || c.WindowS < c.Interval) {
+			v.addError(path+".window_sec", "window %d seconds must be positive and not shorter than interval %d seconds", c.WindowS, c.Interval)
+		}
+	}
+}
+
+func (v *validator) checkTarget(path string, c config.ConditionCriteria) {
+	if c.Target == "" {
+		v.addError(path, "no target given")
+		return
+	}
+	switch c.Type {
+	case "TCPLatency":
+		if _, _, err := net.SplitHostPort(c.Target); err != nil {
+			v.addError(path, "target should be host:port, %s", err.Error())
+		}
+	case "HTTPStatus", "HTTPLatency":
+		u, err := url.Parse(c.Target)
+		if err != nil {
+			v.addError(path, "invalid URL, %s", err.Error())
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			v.addError(path, "unsupported URL scheme %s", u.Scheme)
+		}
+	}
+}
+
+// checkBundles requires archive and destination of each bundle, max_size_MB is unsigned
+// and 0 applies default limit of decompression.
+func (v *validator) checkBundles() {
+	for i, b := range v.cfg.Bundles {
+		path := fmt.Sprintf("$.bundles[%d]", i)
+		if b.Archive == "" {
+			v.addError(path+".archive", "no archive given")
+		}
+		// Extracting into working directory would overwrite files of delegator itself.
+		if b.Destination == "" {
+			v.addError(path+".destination", "no destination given")
+		}
+	}
+}
+
+func (v *validator) checkUpload() {
+	u := &v.cfg.Upload
+	// Zero timeout expires upload context before the first request is sent.
+	if u.TimeoutS == 0 {
+		v.addError("$.upload.timeout_sec", "timeout must be positive")
+	}
+	if !zip.IsValidCompressFormat(u.CompressFormat) {
+		v.addError("$.upload.compress_format", "unknown compress format %s", u.CompressFormat)
+	}
+	if u.Encryption.RecipientPublicKey != "" {
+		if _, err := crypto.LoadRecipientPublicKey(u.Encryption.RecipientPublicKey); err != nil {
+			v.addError("$.upload.encryption.recipient_public_key", "invalid recipient public key, %s", err.Error())
+		}
+	}
+
+	backend := u.Backend
+	if backend == "" {
+		return
+	}
+	if _, ok := upload.UploaderMap[backend]; !ok {
+		v.addError("$.upload.backend", "unknown upload backend %s", backend)
+	}
+	switch backend {
+	case upload.BackendHTTP:
+		v.checkURL("$.upload.http.url", u.HTTP.URL)
+	case upload.BackendS3:
+		// Endpoint defaults to AWS endpoint of region, host without scheme uses https.
+		if u.S3.Endpoint != "" && strings.Contains(u.S3.Endpoint, "://") {
+			v.checkURL("$.upload.s3.endpoint", u.S3.Endpoint)
+		}
+		if u.S3.Bucket == "" {
+			v.addError("$.upload.s3.bucket", "no bucket given")
+		}
+		if u.S3.AccessKeyID == "" {
+			v.addError("$.upload.s3.access_key_id", "no access key ID given")
+		}
+		if u.S3.SecretAccessKey == "" {
+			v.addError("$.upload.s3.secret_access_key", "no secret access key given")
+		}
+	case upload.BackendLocal:
+		if u.Local.Directory == "" {
+			v.addError("$.upload.local.directory", "no directory given")
+		}
+	}
+}
+
+func (v *validator) checkURL(path string, s string) {
+	if s == "" {
+		v.addError(path, "no URL given")
+	} else if u, err := url.Parse(s); err != nil {
+		v.addError(path, "invalid URL, %s", err.Error())
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		v.addError(path, "unsupported URL scheme %s", u.Scheme)
+	}
+}
+
+func (v *validator) checkProxy() {
+	switch strings.ToLower(v.cfg.Upload.Proxy.Auth) {
+	case upload.ProxyAuthNone, upload.ProxyAuthBasic, upload.ProxyAuthNTLM:
+	default:
+		v.addError("$.upload.proxy.auth", "unknown proxy auth %s", v.cfg.Upload.Proxy.Auth)
+	}
+}
@@ -0,0 +1,165 @@
+package validation
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"scp_delegator/config"
+	"scp_delegator/crypto"
+	"scp_delegator/task"
+	"scp_delegator/upload"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// validConfig returns config which passes validation, cases break one field of it.
+func validConfig() *config.Config {
+	return &config.Config{
+		Tasks: []config.Task{{ID: 1, ConditionID: 1, ActionID: 1}},
+		Template: config.Template{
+			Actions:           []config.Action{{ID: 1, Kind: task.ActionKindSystemInfo, Output: "system_info.txt", Property: 1}},
+			ActionsProperties: []config.ActionProperty{{ID: 1, TimeoutS: 600}},
+			Conditions: []config.Condition{{ID: 1, TimeoutS: 600,
+				Criteria: config.Criteria{Mandatory: []uint32{1}}}},
+			ConditionCriteria: []config.ConditionCriteria{{ID: 1, Type: "FileExists", Interval: 5, Operator: "==",
+				Threshold: config.Threshold{Value: 1}, Paths: []string{"flag.txt"}}},
+		},
+		Upload: config.Upload{
+			Backend:        upload.BackendAzBlob,
+			TimeoutS:       300,
+			CompressFormat: "zip",
+		},
+		Bundles: []config.Bundle{{Archive: "tools.zip", Destination: "tools"}},
+	}
+}
+
+func errorPaths(errs Errors) []string {
+	paths := make([]string, len(errs))
+	for i, e := range errs {
+		paths[i] = e.Path
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestValidateValidConfig(t *testing.T) {
+	if err := Validate(validConfig()); err != nil {
+		t.Fatalf("valid config is refused, %s", err)
+	}
+
+	// Compress format is case-insensitive and defaults to zip.
+	for _, format := range []string{"", "ZIP", "tar.gz", "TGZ"} {
+		cfg := validConfig()
+		cfg.Upload.CompressFormat = format
+		if err := Validate(cfg); err != nil {
+			t.Errorf("config with compress format %q is refused, %s", format, err)
+		}
+	}
+
+	// Each backend is accepted with its required fields.
+	backends := map[string]func(*config.Upload){
+		upload.BackendS3: func(u *config.Upload) {
+			u.S3 = config.S3{Region: "eu-west-1", Bucket: "logs", AccessKeyID: "id", SecretAccessKey: "secret"}
+		},
+		upload.BackendLocal: func(u *config.Upload) { u.Local.Directory = `\\server\share` },
+		upload.BackendHTTP:  func(u *config.Upload) { u.HTTP.URL = "https://example.com/{file_name}" },
+	}
+	for backend, set := range backends {
+		cfg := validConfig()
+		cfg.Upload.Backend = backend
+		set(&cfg.Upload)
+		if err := Validate(cfg); err != nil {
+			t.Errorf("config with %s backend is refused, %s", backend, err)
+		}
+	}
+}
+
+func TestValidateRecipientPublicKey(t *testing.T) {
+	_, pubPEM, err := crypto.GenerateRecipientKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "recipient.pem")
+	if err := ioutil.WriteFile(keyFile, pubPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, valid := range map[string]bool{
+		string(pubPEM): true,
+		keyFile:        true,
+		filepath.Join(filepath.Dir(keyFile), "missing.pem"): false,
+		"not a key": false,
+	} {
+		cfg := validConfig()
+		cfg.Upload.Encryption.RecipientPublicKey = key
+		errs := Check(cfg)
+		if valid && len(errs) != 0 {
+			t.Errorf("recipient key %.20q is refused, %s", key, errs)
+		}
+		if !valid && (len(errs) != 1 || errs[0].Path != "$.upload.encryption.recipient_public_key") {
+			t.Errorf("recipient key %.20q returns errors %v", key, errorPaths(errs))
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(*config.Config)
+		want   []string
+	}{
+		{"bundle without archive and destination", func(c *config.Config) {
+			c.Bundles = append(c.Bundles, config.Bundle{MaxSizeMB: 10})
+		}, []string{"$.bundles[1].archive", "$.bundles[1].destination"}},
+		{"bundle without destination", func(c *config.Config) {
+			c.Bundles[0].Destination = ""
+		}, []string{"$.bundles[0].destination"}},
+		{"zero upload timeout", func(c *config.Config) {
+			c.Upload.TimeoutS = 0
+		}, []string{"$.upload.timeout_sec"}},
+		{"zero condition timeout", func(c *config.Config) {
+			c.Template.Conditions[0].TimeoutS = 0
+		}, []string{"$.template.conditions[0].timeout_sec"}},
+		{"unknown compress format", func(c *config.Config) {
+			c.Upload.CompressFormat = "rar"
+		}, []string{"$.upload.compress_format"}},
+		{"unknown backend", func(c *config.Config) {
+			c.Upload.Backend = "ftp"
+		}, []string{"$.upload.backend"}},
+		{"empty S3 setting", func(c *config.Config) {
+			c.Upload.Backend = upload.BackendS3
+		}, []string{"$.upload.s3.access_key_id", "$.upload.s3.bucket", "$.upload.s3.secret_access_key"}},
+		{"S3 endpoint with unsupported scheme", func(c *config.Config) {
+			c.Upload.Backend = upload.BackendS3
+			c.Upload.S3 = config.S3{Endpoint: "ftp://minio.local", Bucket: "logs", AccessKeyID: "id", SecretAccessKey: "secret"}
+		}, []string{"$.upload.s3.endpoint"}},
+		{"empty local directory", func(c *config.Config) {
+			c.Upload.Backend = upload.BackendLocal
+		}, []string{"$.upload.local.directory"}},
+		{"empty HTTP URL", func(c *config.Config) {
+			c.Upload.Backend = upload.BackendHTTP
+		}, []string{"$.upload.http.url"}},
+		{"dangling references", func(c *config.Config) {
+			c.Tasks[0].ActionID = 2
+			c.Template.Conditions[0].Criteria.Optional = []uint32{3}
+		}, []string{"$.tasks[0].action", "$.template.conditions[0].criteria.optional[0]"}},
+		{"native output outside output directory", func(c *config.Config) {
+			c.Template.Actions[0].Output = "../system_info.txt"
+		}, []string{"$.template.actions[0].output"}},
+		{"duplicate ID", func(c *config.Config) {
+			c.Tasks = append(c.Tasks, c.Tasks[0])
+		}, []string{"$.tasks[1].id"}},
+		{"invalid criteria", func(c *config.Config) {
+			c.Template.ConditionCriteria[0].Operator = "=~"
+			c.Template.ConditionCriteria[0].Paths = nil
+		}, []string{"$.template.condition_criteria[0].operator", "$.template.condition_criteria[0].paths"}},
+	}
+	for _, c := range cases {
+		cfg := validConfig()
+		c.modify(cfg)
+		got := errorPaths(Check(cfg))
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("config with %s returns errors %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -1,79 +1,228 @@
 package zip
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/beevik/guid"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"scp_delegator/config"
 	"scp_delegator/constant"
 	"scp_delegator/logger"
+	"strings"
 )
 
-// CompressLogDir will use 7z tool to compress directory/file into .7z/.zip file.
+// archiveWriter is common interface of supported archive formats.
+type archiveWriter interface {
+	addFile(name string, info os.FileInfo, path string) error
+	addDir(name string, info os.FileInfo) error
+	Close() error
+}
+
+// CompressLogDir will compress directory/file into .zip/.tar.gz file, split by max block size of upload setting.
 func CompressLogDir(ctx *context.Context, cfg *config.Upload, logDir string) ([]string, error) {
-	toolPath := getZipToolPath()
-	if toolPath == "" {
-		return nil, errors.New("can't get zip tool path")
+	format := getCompressFormat(cfg)
+	if format == "" {
+		return nil, errors.New(fmt.Sprintf("unsupported compress format %s", cfg.CompressFormat))
 	}
 
-	filePath := getOutputFilePath()
+	filePath := getOutputFilePath(format)
 	if filePath == "" {
 		return nil, errors.New("can't get compress file output path")
 	}
 
+	info, err := os.Stat(logDir)
+	if err != nil {
+		return nil, err
+	}
+	logger.Wrapper.LogTrace("Compressing %s to %s with format %s, volume size %d MB", logDir, filePath, format, cfg.MaxBlockSizeMB)
 
+	// Close logger to prevent log file changed in compressing.
+	logger.Wrapper.Close()
 
-	// Compose exec command
-	cmd := exec.CommandContext(*ctx, toolPath, "a", filePath, logDir,
-		fmt.Sprintf("-v%dm", cfg.MaxBlockSizeMB), "-mmt1")
-	logger.Wrapper.LogTrace("Exec compressing with command: %s", cmd.String())
+	volume := newVolumeWriter(filePath, int64(cfg.MaxBlockSizeMB)<<20)
+	archive := newArchiveWriter(format, volume)
+	err = writeArchive(ctx, archive, logDir, info)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
 
-	// Close logger to prevent file lock in compressing.
-	logger.Wrapper.Close()
-	s, err := cmd.Output()
-	logger.Wrapper.LogTrace("Compressing result: %s", s)
+	var segments []string
+	if err == nil {
+		segments, err = volume.Close()
+	}
 	if err != nil {
+		volume.Remove()
+		logger.Wrapper.LogError("Compressing %s failed with error %s", logDir, err)
 		return nil, err
 	}
 
-	return getCompressedSegments(filePath)
+	logger.Wrapper.LogTrace("Compressing result: %d segments, %s", len(segments), strings.Join(segments, ", "))
+	return segments, nil
+}
+
+func writeArchive(ctx *context.Context, archive archiveWriter, target string, info os.FileInfo) error {
+	if !info.IsDir() {
+		return archive.addFile(info.Name(), info, target)
+	}
+
+	// Keep directory name as root of archive.
+	root := filepath.Dir(target)
+	return filepath.Walk(target, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		select {
+		case <-(*ctx).Done():
+			return (*ctx).Err()
+		default:
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if fi.IsDir() {
+			return archive.addDir(name, fi)
+		}
+		if !fi.Mode().IsRegular() {
+			// Skip symbolic links, devices and other special files.
+			return nil
+		}
+		return archive.addFile(name, fi, path)
+	})
 }
 
-func getCompressedSegments(compressedFilePath string) ([]string, error) {
-	pattern := compressedFilePath + ".*"
-	files, err := filepath.Glob(pattern)
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == constant.CompressFormatTarGz {
+		gw := gzip.NewWriter(w)
+		return &tarGzArchive{gzipWriter: gw, tarWriter: tar.NewWriter(gw)}
+	}
+	return &zipArchive{zipWriter: zip.NewWriter(w)}
+}
+
+type zipArchive struct {
+	zipWriter *zip.Writer
+}
+
+func (a *zipArchive) addDir(name string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return files, nil
+	header.Name = name + "/"
+	_, err = a.zipWriter.CreateHeader(header)
+	return err
 }
 
-func getOutputFilePath() string {
-	p, err := os.Getwd()
+func (a *zipArchive) addFile(name string, info os.FileInfo, path string) error {
+	header, err := zip.FileInfoHeader(info)
 	if err != nil {
-		return ""
+		return err
 	}
-	fileName := guid.NewString() +"_" +constant.CompressedFileName
-	return filepath.Join(p, fileName)
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := a.zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	return copyFile(w, path, -1)
 }
 
-func getZipToolPath() string {
-	p, err := os.Getwd()
+func (a *zipArchive) Close() error {
+	return a.zipWriter.Close()
+}
+
+type tarGzArchive struct {
+	gzipWriter *gzip.Writer
+	tarWriter  *tar.Writer
+}
+
+func (a *tarGzArchive) addDir(name string, info os.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
 	if err != nil {
-		return ""
+		return err
 	}
+	header.Name = name + "/"
+	return a.tarWriter.WriteHeader(header)
+}
 
-	if runtime.GOOS == "windows" {
-		return filepath.Join(p, constant.WindowsZipToolBinary)
-	} else if runtime.GOOS == "linux" {
-		// TODO: Assign linux tgz tool
-		return ""
-	} else {
+func (a *tarGzArchive) addFile(name string, info os.FileInfo, path string) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := a.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	// Tar header already records file size, so copy exactly that size even if file is still growing.
+	return copyFile(a.tarWriter, path, info.Size())
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tarWriter.Close(); err != nil {
+		return err
+	}
+	return a.gzipWriter.Close()
+}
+
+func copyFile(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if size < 0 {
+		_, err = io.Copy(w, f)
+		return err
+	}
+	n, err := io.CopyN(w, f, size)
+	if err == io.EOF {
+		// File truncated after header written, pad rest with zero.
+		_, err = io.CopyN(w, zeroReader{}, size-n)
+	}
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// IsValidCompressFormat returns true if format is zip, tar.gz or tgz in any case, empty format is zip.
+func IsValidCompressFormat(format string) bool {
+	return getCompressFormat(&config.Upload{CompressFormat: format}) != ""
+}
+
+func getCompressFormat(cfg *config.Upload) string {
+	switch strings.ToLower(cfg.CompressFormat) {
+	case "", constant.CompressFormatZip:
+		return constant.CompressFormatZip
+	case constant.CompressFormatTarGz, "tgz":
+		return constant.CompressFormatTarGz
+	}
+	return ""
+}
+
+func getOutputFilePath(format string) string {
+	p, err := os.Getwd()
+	if err != nil {
 		return ""
 	}
+	fileName := guid.NewString() + "_" + constant.CompressedFileName + "." + format
+	return filepath.Join(p, fileName)
 }
@@ -1 +1,519 @@
 package zip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"scp_delegator/logger"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultMaxTotalBytes = 4 << 30
+	DefaultMaxFileBytes  = 2 << 30
+	DefaultMaxEntries    = 100000
+)
+
+const (
+	formatUnknown = iota
+	formatZip
+	formatGzip
+	format7z
+)
+
+var (
+	magicZip  = []byte{'P', 'K', 0x03, 0x04}
+	magicGzip = []byte{0x1f, 0x8b}
+	magic7z   = []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}
+)
+
+var segmentSuffix = regexp.MustCompile(`\.(\d{3})$`)
+
+// DecompressOptions limits extraction of archive which comes from untrusted source.
+type DecompressOptions struct {
+	MaxTotalBytes int64
+	MaxFileBytes  int64
+	MaxEntries    int
+}
+
+func (o *DecompressOptions) withDefault() DecompressOptions {
+	r := DecompressOptions{
+		MaxTotalBytes: DefaultMaxTotalBytes,
+		MaxFileBytes:  DefaultMaxFileBytes,
+		MaxEntries:    DefaultMaxEntries,
+	}
+	if o == nil {
+		return r
+	}
+	if o.MaxTotalBytes > 0 {
+		r.MaxTotalBytes = o.MaxTotalBytes
+	}
+	if o.MaxFileBytes > 0 {
+		r.MaxFileBytes = o.MaxFileBytes
+	}
+	if o.MaxEntries > 0 {
+		r.MaxEntries = o.MaxEntries
+	}
+	return r
+}
+
+// FindSegments returns all volumes of archive in order, path can be either archive itself or any of its segments.
+func FindSegments(archivePath string) ([]string, error) {
+	base := archivePath
+	if segmentSuffix.MatchString(archivePath) {
+		base = segmentSuffix.ReplaceAllString(archivePath, "")
+	}
+
+	if _, err := os.Stat(base); err == nil {
+		return []string{base}, nil
+	}
+
+	files, err := filepath.Glob(base + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]string, 0, len(files))
+	for _, f := range files {
+		if segmentSuffix.MatchString(f) {
+			segments = append(segments, f)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, errors.New(fmt.Sprintf("can't find archive or segments of %s", archivePath))
+	}
+	sort.Strings(segments)
+
+	// Segments must be continuous, otherwise archive is broken.
+	for i, s := range segments {
+		n, _ := strconv.Atoi(segmentSuffix.FindStringSubmatch(s)[1])
+		if n != i+1 {
+			return nil, errors.New(fmt.Sprintf("segment %03d of %s is missing", i+1, base))
+		}
+	}
+	return segments, nil
+}
+
+// Decompress reassembles segments and extracts them into destDir, returns extracted file paths.
+func Decompress(ctx *context.Context, segments []string, destDir string, opts *DecompressOptions) ([]string, error) {
+	if len(segments) == 0 {
+		return nil, errors.New("no archive segment given")
+	}
+	limits := opts.withDefault()
+
+	destDir, err := filepath.Abs(destDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(destDir, 0744); err != nil {
+		return nil, err
+	}
+
+	reader, err := openSegments(segments)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	format, err := detectFormat(reader)
+	if err != nil {
+		return nil, err
+	}
+	logger.Wrapper.LogTrace("Decompressing %d segments of %s to %s", len(segments), segments[0], destDir)
+
+	ex := &extractor{ctx: ctx, destDir: destDir, limits: limits}
+	switch format {
+	case formatZip:
+		err = ex.extractZip(reader)
+	case formatGzip:
+		err = ex.extractTarGz(io.NewSectionReader(reader, 0, reader.size))
+	case format7z:
+		err = ex.extract7z(segments)
+	default:
+		err = errors.New(fmt.Sprintf("unrecognized archive format of %s", segments[0]))
+	}
+	if err != nil {
+		logger.Wrapper.LogError("Decompressing %s failed with error %s", segments[0], err)
+		return ex.files, err
+	}
+	return ex.files, nil
+}
+
+func detectFormat(r io.ReaderAt) (int, error) {
+	head := make([]byte, 8)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return formatUnknown, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, magicZip):
+		return formatZip, nil
+	case bytes.HasPrefix(head, magicGzip):
+		return formatGzip, nil
+	case bytes.HasPrefix(head, magic7z):
+		return format7z, nil
+	}
+	return formatUnknown, nil
+}
+
+type extractor struct {
+	ctx     *context.Context
+	destDir string
+	limits  DecompressOptions
+
+	entries    int
+	totalBytes int64
+	files      []string
+}
+
+// targetPath resolves entry name under destination directory and rejects any path escaping it.
+func (e *extractor) targetPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" || strings.Contains(name, ":") {
+		return "", errors.New(fmt.Sprintf("illegal absolute path %s in archive", name))
+	}
+
+	p := filepath.Join(e.destDir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(e.destDir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New(fmt.Sprintf("illegal path %s escapes destination directory", name))
+	}
+	return p, nil
+}
+
+func (e *extractor) nextEntry() error {
+	select {
+	case <-(*e.ctx).Done():
+		return (*e.ctx).Err()
+	default:
+	}
+
+	e.entries++
+	if e.entries > e.limits.MaxEntries {
+		return errors.New(fmt.Sprintf("archive has more than %d entries", e.limits.MaxEntries))
+	}
+	return nil
+}
+
+func (e *extractor) writeFile(name string, r io.Reader, mode os.FileMode) error {
+	p, err := e.targetPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0744); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	limit := e.limits.MaxFileBytes
+	if remain := e.limits.MaxTotalBytes - e.totalBytes; remain < limit {
+		limit = remain
+	}
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if err == nil && n > limit {
+		err = errors.New(fmt.Sprintf("entry %s exceeds size limit, file limit %d bytes, total limit %d bytes",
+			name, e.limits.MaxFileBytes, e.limits.MaxTotalBytes))
+	}
+	if err != nil {
+		// Don't leave truncated file behind, it isn't counted in total size either.
+		_ = f.Close()
+		_ = os.Remove(p)
+		return err
+	}
+	e.totalBytes += n
+
+	e.files = append(e.files, p)
+	return nil
+}
+
+func (e *extractor) makeDir(name string) error {
+	p, err := e.targetPath(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0744)
+}
+
+func (e *extractor) extractZip(r *segmentReader) error {
+	zr, err := zip.NewReader(r, r.size)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if err := e.nextEntry(); err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = e.makeDir(f.Name)
+		case mode.IsRegular():
+			if f.UncompressedSize64 > uint64(e.limits.MaxFileBytes) {
+				return errors.New(fmt.Sprintf("entry %s exceeds file size limit %d bytes", f.Name, e.limits.MaxFileBytes))
+			}
+			err = e.extractZipFile(f)
+		default:
+			logger.Wrapper.LogInfo("Skip non-regular entry %s in archive", f.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) extractZipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return e.writeFile(f.Name, rc, f.Mode())
+}
+
+func (e *extractor) extractTarGz(r io.Reader) error {
+	gr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := e.nextEntry(); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.makeDir(header.Name)
+		case tar.TypeReg:
+			err = e.writeFile(header.Name, tr, os.FileMode(header.Mode))
+		default:
+			logger.Wrapper.LogInfo("Skip non-regular entry %s in archive", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extract7z handles legacy .7z archives which uploaded by previous version, it requires 7z tool.
+// The tool writes into a staging directory, and entries are moved to destination only after
+// they are checked, since listing of archive can't be trusted to describe what is extracted.
+func (e *extractor) extract7z(segments []string) error {
+	toolPath := get7zToolPath()
+	if toolPath == "" {
+		return errors.New("can't find 7z tool to extract legacy 7z archive")
+	}
+
+	// List entries first, so limits and paths are validated before anything written.
+	cmd := exec.CommandContext(*e.ctx, toolPath, "l", "-slt", segments[0])
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	var totalBytes int64
+	var entries int
+	var entry string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "Path = ") {
+			entry = strings.TrimPrefix(line, "Path = ")
+			if entry == segments[0] || entry == filepath.Base(segments[0]) {
+				// Header of archive itself.
+				entry = ""
+				continue
+			}
+			entries++
+			if entries > e.limits.MaxEntries {
+				return errors.New(fmt.Sprintf("archive has more than %d entries", e.limits.MaxEntries))
+			}
+			if _, err := e.targetPath(entry); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(line, "Size = ") && entry != "" {
+			size, _ := strconv.ParseInt(strings.TrimPrefix(line, "Size = "), 10, 64)
+			if size > e.limits.MaxFileBytes {
+				return errors.New(fmt.Sprintf("entry %s exceeds file size limit %d bytes", entry, e.limits.MaxFileBytes))
+			}
+			totalBytes += size
+			if totalBytes > e.limits.MaxTotalBytes {
+				return errors.New(fmt.Sprintf("archive exceeds total size limit %d bytes", e.limits.MaxTotalBytes))
+			}
+		}
+	}
+
+	staging, err := ioutil.TempDir(e.destDir, ".7z-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	// -snl- stores symbolic links as plain files instead of creating links.
+	cmd = exec.CommandContext(*e.ctx, toolPath, "x", segments[0], "-o"+staging, "-y", "-snl-")
+	logger.Wrapper.LogTrace("Exec decompressing with command: %s", cmd.String())
+	out, err = cmd.Output()
+	logger.Wrapper.LogTrace("Decompressing result: %s", out)
+	if err != nil {
+		return err
+	}
+	return e.moveExtracted(staging)
+}
+
+// moveExtracted checks entries extracted by external tool against limits, then moves them to destination.
+func (e *extractor) moveExtracted(staging string) error {
+	return filepath.Walk(staging, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == staging {
+			return err
+		}
+		name, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		if err := e.nextEntry(); err != nil {
+			return err
+		}
+
+		// Walk doesn't follow symbolic links, so info describes entry itself.
+		switch {
+		case info.IsDir():
+			return e.makeDir(name)
+		case info.Mode().IsRegular():
+			if info.Size() > e.limits.MaxFileBytes || e.totalBytes+info.Size() > e.limits.MaxTotalBytes {
+				return errors.New(fmt.Sprintf("entry %s exceeds size limit, file limit %d bytes, total limit %d bytes",
+					name, e.limits.MaxFileBytes, e.limits.MaxTotalBytes))
+			}
+			p, err := e.targetPath(name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0744); err != nil {
+				return err
+			}
+			if err := os.Rename(path, p); err != nil {
+				return err
+			}
+			e.totalBytes += info.Size()
+			e.files = append(e.files, p)
+		default:
+			logger.Wrapper.LogInfo("Skip non-regular entry %s in archive", name)
+		}
+		return nil
+	})
+}
+
+// get7zToolPath returns 7z tool shipped beside the executable, or the one installed in system.
+// Working directory is never searched, it may be writable by anyone who drops an archive.
+func get7zToolPath() string {
+	name := "7z"
+	if runtime.GOOS == "windows" {
+		name = "7z.exe"
+	}
+
+	if p, err := os.Executable(); err == nil {
+		shipped := filepath.Join(filepath.Dir(p), name)
+		if _, err := os.Stat(shipped); err == nil {
+			return shipped
+		}
+	}
+	if p, err := exec.LookPath(name); err == nil && filepath.IsAbs(p) {
+		return p
+	}
+	return ""
+}
+
+// segmentReader presents ordered segment files as one continuous io.ReaderAt.
+type segmentReader struct {
+	files   []*os.File
+	offsets []int64
+	size    int64
+}
+
+func openSegments(segments []string) (*segmentReader, error) {
+	r := &segmentReader{}
+	for _, s := range segments {
+		f, err := os.Open(s)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			r.Close()
+			return nil, err
+		}
+		r.files = append(r.files, f)
+		r.offsets = append(r.offsets, r.size)
+		r.size += info.Size()
+	}
+	return r, nil
+}
+
+func (r *segmentReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	// Find the segment contains offset.
+	i := sort.Search(len(r.offsets), func(i int) bool { return r.offsets[i] > off }) - 1
+
+	total := 0
+	for total < len(p) && i < len(r.files) {
+		n, err := r.files[i].ReadAt(p[total:], off-r.offsets[i])
+		total += n
+		off += int64(n)
+		if err == io.EOF {
+			i++
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	if total < len(p) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+func (r *segmentReader) Close() {
+	for _, f := range r.files {
+		f.Close()
+	}
+}
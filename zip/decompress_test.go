@@ -0,0 +1,253 @@
+package zip
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"scp_delegator/constant"
+	"scp_delegator/logger"
+	"testing"
+)
+
+// useTestLog writes log into temporary directory of test instead of output directory under the package.
+func useTestLog(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), constant.LogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Wrapper.SetOutput(f)
+	t.Cleanup(func() {
+		logger.Wrapper.SetOutput(ioutil.Discard)
+		_ = f.Close()
+	})
+}
+
+// writeTestSource creates directory "src" with given files, returns path of the directory.
+func writeTestSource(t *testing.T, files map[string][]byte) string {
+	src := filepath.Join(t.TempDir(), "src")
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+// writeTestArchive compresses src in format and splits it by volumeSize, returns segment paths.
+func writeTestArchive(t *testing.T, src string, format string, volumeSize int64) []string {
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	volume := newVolumeWriter(filepath.Join(t.TempDir(), "archive."+format), volumeSize)
+	archive := newArchiveWriter(format, volume)
+	if err := writeArchive(&ctx, archive, src, info); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := volume.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segments
+}
+
+func TestTargetPath(t *testing.T) {
+	dest := t.TempDir()
+	e := &extractor{destDir: dest}
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"a.txt", filepath.Join(dest, "a.txt")},
+		{"dir/a.txt", filepath.Join(dest, "dir", "a.txt")},
+		{`dir\a.txt`, filepath.Join(dest, "dir", "a.txt")},
+		{"dir/../a.txt", filepath.Join(dest, "a.txt")},
+		{"..", ""},
+		{"../a.txt", ""},
+		{`..\a.txt`, ""},
+		{"dir/../../a.txt", ""},
+		{"/etc/passwd", ""},
+		{`\Windows\win.ini`, ""},
+		{`\\server\share\a.txt`, ""},
+		{`C:\Windows\win.ini`, ""},
+		{"C:/Windows/win.ini", ""},
+		{"C:a.txt", ""},
+		{"dir/a.txt:stream", ""},
+	}
+	for _, c := range cases {
+		got, err := e.targetPath(c.name)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("targetPath(%q) = %s, should be refused", c.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("targetPath(%q) returns error %s", c.name, err)
+		} else if got != c.want {
+			t.Errorf("targetPath(%q) = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	useTestLog(t)
+	src := writeTestSource(t, map[string][]byte{
+		"a.txt": bytes.Repeat([]byte("a"), 100),
+		"b.txt": bytes.Repeat([]byte("b"), 100),
+	})
+	cases := []struct {
+		opts     DecompressOptions
+		extracts []string
+		refuses  string
+	}{
+		{DecompressOptions{}, []string{"a.txt", "b.txt"}, ""},
+		{DecompressOptions{MaxFileBytes: 100}, []string{"a.txt", "b.txt"}, ""},
+		{DecompressOptions{MaxFileBytes: 99}, nil, "a.txt"},
+		{DecompressOptions{MaxTotalBytes: 150}, []string{"a.txt"}, "b.txt"},
+		// Directory "src" itself is an entry too.
+		{DecompressOptions{MaxEntries: 2}, []string{"a.txt"}, "b.txt"},
+	}
+	for _, format := range []string{constant.CompressFormatZip, constant.CompressFormatTarGz} {
+		segments := writeTestArchive(t, src, format, 0)
+		for _, c := range cases {
+			dest := t.TempDir()
+			ctx := context.Background()
+			_, err := Decompress(&ctx, segments, dest, &c.opts)
+			if (err != nil) != (c.refuses != "") {
+				t.Errorf("decompressing %s with %+v returns error %v", format, c.opts, err)
+			}
+			for _, name := range c.extracts {
+				if _, err := os.Stat(filepath.Join(dest, "src", name)); err != nil {
+					t.Errorf("%s isn't extracted from %s with %+v", name, format, c.opts)
+				}
+			}
+			if c.refuses == "" {
+				continue
+			}
+			// Neither truncated nor empty file is left for refused entry.
+			if _, err := os.Stat(filepath.Join(dest, "src", c.refuses)); !os.IsNotExist(err) {
+				t.Errorf("refused entry %s is left in %s with %+v", c.refuses, format, c.opts)
+			}
+		}
+	}
+}
+
+func TestDecompressSegments(t *testing.T) {
+	useTestLog(t)
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := map[string][]byte{
+		"random.bin":   random,
+		"sub/note.txt": []byte("note"),
+		"empty.txt":    {},
+	}
+	src := writeTestSource(t, files)
+
+	for _, format := range []string{constant.CompressFormatZip, constant.CompressFormatTarGz} {
+		segments := writeTestArchive(t, src, format, 4096)
+		if len(segments) < 5 {
+			t.Fatalf("%s archive is split into %d segments", format, len(segments))
+		}
+
+		// Any segment leads to all of them.
+		found, err := FindSegments(segments[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(found, segments) {
+			t.Errorf("FindSegments of %s = %v, want %v", format, found, segments)
+		}
+
+		// Reader reads across segment boundary.
+		var whole []byte
+		for _, s := range segments {
+			b, err := ioutil.ReadFile(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			whole = append(whole, b...)
+		}
+		r, err := openSegments(segments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.size != int64(len(whole)) {
+			t.Errorf("size of %s segments = %d, want %d", format, r.size, len(whole))
+		}
+		buf := make([]byte, 5000)
+		if n, err := r.ReadAt(buf, 3000); err != nil || !bytes.Equal(buf[:n], whole[3000:8000]) {
+			t.Errorf("ReadAt across segments of %s reads %d bytes, error %v", format, n, err)
+		}
+		if _, err := r.ReadAt(buf, r.size-10); err == nil {
+			t.Errorf("ReadAt beyond end of %s segments should fail", format)
+		}
+		r.Close()
+
+		dest := t.TempDir()
+		ctx := context.Background()
+		extracted, err := Decompress(&ctx, found, dest, nil)
+		if err != nil {
+			t.Fatalf("decompressing %s failed with error %s", format, err)
+		}
+		if len(extracted) != len(files) {
+			t.Errorf("%d files are extracted from %s, want %d", len(extracted), format, len(files))
+		}
+		for name, content := range files {
+			b, err := ioutil.ReadFile(filepath.Join(dest, "src", filepath.FromSlash(name)))
+			if err != nil || !bytes.Equal(b, content) {
+				t.Errorf("%s extracted from %s doesn't match source, error %v", name, format, err)
+			}
+		}
+
+		// Missing segment in the middle breaks archive.
+		if err := os.Remove(segments[2]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := FindSegments(segments[0]); err == nil {
+			t.Errorf("FindSegments of %s should fail when segment 003 is missing", format)
+		}
+	}
+}
+
+func TestMoveExtracted(t *testing.T) {
+	useTestLog(t)
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, limits := range []DecompressOptions{{MaxTotalBytes: 100, MaxFileBytes: 100, MaxEntries: 100}, {MaxTotalBytes: 100, MaxFileBytes: 3, MaxEntries: 100}} {
+		dest := t.TempDir()
+		staging := writeTestSource(t, map[string][]byte{"dir/a.txt": []byte("abcd")})
+		if err := os.Symlink(outside, filepath.Join(staging, "dir", "link")); err != nil {
+			t.Skipf("can't create symbolic link, error %s", err)
+		}
+
+		ctx := context.Background()
+		e := &extractor{ctx: &ctx, destDir: dest, limits: limits}
+		err := e.moveExtracted(staging)
+		if refused := limits.MaxFileBytes < 4; (err != nil) != refused {
+			t.Errorf("moving extracted entries with %+v returns error %v", limits, err)
+		}
+		if _, err := os.Lstat(filepath.Join(dest, "dir", "link")); !os.IsNotExist(err) {
+			t.Errorf("symbolic link is moved to destination with %+v", limits)
+		}
+		_, err = os.Stat(filepath.Join(dest, "dir", "a.txt"))
+		if moved := err == nil; moved != (limits.MaxFileBytes >= 4) || moved != (len(e.files) == 1) {
+			t.Errorf("a.txt moved %v with %+v, files %v", moved, limits, e.files)
+		}
+	}
+}
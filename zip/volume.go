@@ -0,0 +1,100 @@
+package zip
+
+import (
+	"fmt"
+	"os"
+)
+
+// volumeWriter splits written data into fixed size segment files named as <base>.001, <base>.002 ...
+type volumeWriter struct {
+	basePath   string
+	volumeSize int64
+
+	current  *os.File
+	written  int64
+	segments []string
+}
+
+func newVolumeWriter(basePath string, volumeSize int64) *volumeWriter {
+	return &volumeWriter{
+		basePath:   basePath,
+		volumeSize: volumeSize,
+	}
+}
+
+func (v *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if v.current == nil || (v.volumeSize > 0 && v.written >= v.volumeSize) {
+			if err := v.nextVolume(); err != nil {
+				return total, err
+			}
+		}
+
+		chunk := p
+		if v.volumeSize > 0 && int64(len(chunk)) > v.volumeSize-v.written {
+			chunk = chunk[:v.volumeSize-v.written]
+		}
+
+		n, err := v.current.Write(chunk)
+		total += n
+		v.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (v *volumeWriter) nextVolume() error {
+	if err := v.closeCurrent(); err != nil {
+		return err
+	}
+
+	path := v.basePath
+	if v.volumeSize > 0 {
+		path = fmt.Sprintf("%s.%03d", v.basePath, len(v.segments)+1)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	v.current = f
+	v.written = 0
+	v.segments = append(v.segments, path)
+	return nil
+}
+
+func (v *volumeWriter) closeCurrent() error {
+	if v.current == nil {
+		return nil
+	}
+	err := v.current.Close()
+	v.current = nil
+	return err
+}
+
+// Close flushes last segment and returns all segment paths in order.
+func (v *volumeWriter) Close() ([]string, error) {
+	if len(v.segments) == 0 {
+		// Nothing written, still create an empty archive file.
+		if err := v.nextVolume(); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.closeCurrent(); err != nil {
+		return nil, err
+	}
+	return v.segments, nil
+}
+
+// Remove deletes all segments which already created, used when compressing failed.
+func (v *volumeWriter) Remove() {
+	_ = v.closeCurrent()
+	for _, s := range v.segments {
+		_ = os.Remove(s)
+	}
+	v.segments = nil
+}